@@ -1,55 +1,85 @@
 package main
 
 import (
+	"context"
+	"flag"
+	"os"
+	"os/signal"
 	"sync"
+	"syscall"
+	"time"
 
 	"github.com/linushung/artemis/cmd/server"
 	"github.com/linushung/artemis/cmd/server/rest"
 	"github.com/linushung/artemis/internal/app/authorization"
 	"github.com/linushung/artemis/internal/pkg/configs"
+	"github.com/linushung/artemis/internal/pkg/faults"
+	"github.com/linushung/artemis/internal/pkg/logging"
+	"github.com/linushung/artemis/internal/pkg/requestid"
+	"github.com/linushung/artemis/internal/pkg/stub"
+	"github.com/linushung/artemis/internal/pkg/tracing"
 
-	logrustash "github.com/bshuster-repo/logrus-logstash-hook"
 	log "github.com/sirupsen/logrus"
-	//"go.elastic.co/apm/module/apmlogrus"
 )
 
-func initLogrus() {
-	logstashHost := configs.GetConfigStr("connection.logstash.host")
-
-	if logstashHost == "" {
-		log.SetLevel(log.DebugLevel)
-		log.SetFormatter(&log.TextFormatter{
-			// DisableColors: true,
-			TimestampFormat: "2006-01-02 15:04:05.000",
-			FullTimestamp:   true,
-		})
-	} else {
-		log.SetFormatter(&log.JSONFormatter{})
-		hook, err := logrustash.NewHookWithFields("udp", logstashHost, "artemis", log.Fields{})
-		if err != nil {
-			log.Fatal(err)
-		}
-
-		log.AddHook(hook)
-		//log.AddHook(&apmlogrus.Hook{})
+func initLogrus(c logging.Config) {
+	if err := logging.Configure(c); err != nil {
+		log.Fatalf("***** [INIT:LOGGING][FAIL] ***** Failed to init logging configuration:: %v", err)
 	}
+	// Add trace_id, span_id and request_id to entries logged with context of a request, e.g. log.WithContext(ctx)
+	log.AddHook(tracing.LogHook{})
+	log.AddHook(requestid.LogHook{})
+	// Redact secrets and PII before entries are written to sinks, with redaction in effect since it changes on reload
+	log.AddHook(logging.Hook{})
 }
 
-func initService() {
+func initService(c *server.Config) {
 	var wg sync.WaitGroup
-	authorization.InitJWTService()
-	server.InitCircuitBreakerMgr()
-	baseServer := server.NewBaseServer()
+	authorization.InitJWTService(c.Auth)
+	faults.Init(c.FaultInjection)
+	server.InitCircuitBreakerMgr(c.CircuitBreaker)
+	baseServer := server.NewBaseServer(c)
+	// Watch configuration once subsystems have subscribed to their changes
+	server.WatchConfig()
 
 	wg.Add(1)
-	go rest.InitRestServer(*baseServer)
+	go func() {
+		defer wg.Done()
+		rest.InitRestServer(*baseServer)
+	}()
 
 	wg.Wait()
 }
 
+// runStub runs the stub server of httpbin for exercising circuit breakers offline, e.g. "artemis stub -addr :8000"
+func runStub(args []string) {
+	fs := flag.NewFlagSet("stub", flag.ExitOnError)
+	addr := fs.String("addr", ":8000", "address the stub server listens on")
+	fs.Parse(args)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := stub.ListenAndServe(ctx, *addr); err != nil {
+		log.Fatalf("***** [SERVER:STUB][FAIL] ***** Failed to start stub server: %v", err)
+	}
+}
+
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "stub" {
+		runStub(os.Args[2:])
+		return
+	}
+
 	log.Infof("***** [INIT:ARTEMIS] ***** Start to launch Artemis 🤓 ...")
 	configs.InitConfig()
-	initLogrus()
-	initService()
+	c, err := server.LoadConfig(configs.Current())
+	if err != nil {
+		log.Fatalf("***** [INIT:CONFIG][FAIL] ***** Invalid system configuration:: %v", err)
+	}
+	initLogrus(c.Logging)
+	// Deferred functions run in reverse order, so entries logged while shutting down tracing are flushed as well
+	defer logging.Close(5 * time.Second)
+	shutdownTracing := tracing.Init(c.Tracing)
+	defer shutdownTracing(context.Background())
+	initService(c)
 }
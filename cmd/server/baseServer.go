@@ -10,13 +10,15 @@ type BaseServer struct {
 	RDB    postgres.RDB
 	CircuitBreakerManager
 	authorization.JWTMgr
+	Config *Config
 }
 
-// NewBaseServer return an instance of BaseServer struct.
-func NewBaseServer() *BaseServer {
+// NewBaseServer return an instance of BaseServer struct of configuration c.
+func NewBaseServer(c *Config) *BaseServer {
 	return &BaseServer{
-		postgres.InitPostgreSQL(),
+		postgres.InitPostgreSQL(c.Connection.RDB),
 		GetCircuitBreakerMgr(),
 		authorization.GetJWTMgr(),
+		c,
 	}
 }
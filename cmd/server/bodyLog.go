@@ -0,0 +1,61 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/linushung/artemis/internal/pkg/logging"
+)
+
+const defaultBodyLogMaxBytes = 1024
+
+/*
+BodyLogConfig enables logging bodies of requests and responses of a register. It's disabled by default since bodies
+may carry PII, and bodies are truncated to MaxBytes and redacted like any other log entry.
+*/
+type BodyLogConfig struct {
+	Enabled  bool `mapstructure:"enabled" json:"enabled"`
+	MaxBytes int  `mapstructure:"maxbytes" json:"maxBytes"`
+}
+
+// WithDefaults returns a copy of c whose unset fields are replaced with default values
+func (c BodyLogConfig) WithDefaults() BodyLogConfig {
+	if c.MaxBytes <= 0 {
+		c.MaxBytes = defaultBodyLogMaxBytes
+	}
+	return c
+}
+
+// bufferBody reads body of req so it can be logged after it's sent, body is replaced with a reader of the same bytes
+func bufferBody(req *Request) []byte {
+	if req.Body == nil {
+		return nil
+	}
+
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		logger.Warnf("***** [CIRCUITBREAKER] ***** [METHOD:%s] [URL:%s] Cannot buffer request body for logging:: %v", req.Method, req.URL, err)
+	}
+	req.Body = bytes.NewReader(body)
+	return body
+}
+
+// logBodies logs bodies of req and res, which is nil if the request failed
+func (c BodyLogConfig) logBodies(ctx context.Context, register string, req *Request, reqBody []byte, res *Response) {
+	entry := logger.WithContext(ctx).WithFields(log.Fields{
+		"register":     register,
+		"method":       req.Method,
+		"url":          req.URL,
+		"request_body": logging.Truncate(reqBody, c.MaxBytes),
+	})
+	if res != nil {
+		entry = entry.WithFields(log.Fields{
+			"status":        res.StatusCode,
+			"response_body": logging.Truncate(res.Body, c.MaxBytes),
+		})
+	}
+	entry.Infof("***** [CIRCUITBREAKER:%s][BODY] ***** %s %s", register, req.Method, req.URL)
+}
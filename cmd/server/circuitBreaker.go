@@ -1,203 +1,314 @@
 package server
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
-	"io/ioutil"
-	"net"
 	"net/http"
 	"os"
 	"strings"
 	"sync"
+	"time"
 
-	"github.com/hashicorp/go-retryablehttp"
-
+	"github.com/linushung/artemis/internal/pkg/circuitbreaker"
 	"github.com/linushung/artemis/internal/pkg/configs"
+	"github.com/linushung/artemis/internal/pkg/logging"
+	"github.com/linushung/artemis/internal/pkg/tracing"
 
-	"github.com/afex/hystrix-go/hystrix"
-	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// logger is the logger of subsystem circuitbreaker, whose level can be changed at runtime
+var logger = logging.Logger(logging.CircuitBreaker)
+
 /*
-Hystrix Circuit Breaker:
-1. When calls to a particular service exceed circuitBreaker.requestVolumeThreshold (default: 20 requests) and the
-failure percentage is greater than circuitBreaker.errorThresholdPercentage (default: >50%) in a rolling window defined
-by metrics.rollingStats.timeInMilliseconds (default: 10 seconds), the circuit opens and the call is not made.
-2. Due to metrics.rollingStats.timeInMilliseconds default to 10 seconds, it may not work well to catch timeout error...
+Circuit Breaker:
+1. When calls to a particular register exceed requestvolumethreshold (default: 20 requests) and the failure percentage
+reaches errorpercentthreshold (default: 50%) in a sliding window of rollingwindow (default: 10 seconds), the circuit
+opens and the call is not made.
+2. After sleepwindow, halfopenprobes requests are let through to probe for recovery. See package circuitbreaker.
+3. Each register is isolated by its own connection pool (transport), bulkhead (maxconcurrentrequests, maxqueue and
+queuetimeout) and token bucket rate limiter (ratelimit), so one slow partner doesn't starve the others.
 */
 var (
 	once     sync.Once
 	instance CircuitBreakerManager
 	/*
 		Timeout value has to be considered with timeout of http.Client in order for consistent response. Set
-		this value a little less than http.Client makes http request mainly handle by hystrix
+		this value a little less than http.Client makes http request mainly handle by circuit breaker
 	*/
 	// Timeout is how long to wait for command to complete, in milliseconds
 	defaultTimeout = 5000
 	// MaxConcurrent is how many commands of the same type can run at the same time
 	defaultMaxConcurrent = 50
-	// VolumeThreshold is the minimum number of requests needed before a circuit can be tripped due to health
-	defaultVolumeThreshold = hystrix.DefaultVolumeThreshold
-	// SleepWindow is how long, in milliseconds, to wait after a circuit opens before testing for recovery
-	defaultSleepWindow = hystrix.DefaultSleepWindow
-	// ErrorPercentThreshold causes circuits to open once the rolling measure of errors exceeds this percent of requests
-	defaultErrorPercentThreshold = hystrix.DefaultErrorPercentThreshold
+
+	// NewCircuitBreaker creates the circuit breaker of a register. Replace it before InitCircuitBreakerMgr to plug in
+	// another implementation of circuitbreaker.CircuitBreaker
+	NewCircuitBreaker = func(name string, c circuitbreaker.Config) circuitbreaker.CircuitBreaker {
+		return circuitbreaker.New(name, c)
+	}
 )
 
 const (
 	DefaultHandler = "GeneralEventHandler"
+	// defaultBaseURL is the httpbin which downstream of registers without baseurl was hardcoded to
+	defaultBaseURL = "http://localhost:8000"
 )
 
 type circuitBreakerConfig struct {
-	Timeout                int  `mapstructure:"timeout"`
-	MaxConcurrentRequests  int  `mapstructure:"maxconcurrentrequests"`
-	RequestVolumeThreshold int  `mapstructure:"requestvolumethreshold"`
-	SleepWindow            int  `mapstructure:"sleepwindow"`
-	ErrorPercentThreshold  int  `mapstructure:"errorpercentthreshold"`
-	Retryable              bool `mapstructure:"retryable"`
+	circuitbreaker.Config `mapstructure:",squash"`
+	// BaseURL is the URL of downstream which paths of requests are relative to, see URLOf
+	BaseURL   string `mapstructure:"baseurl"`
+	Retryable bool   `mapstructure:"retryable"`
+	// Retry is the retry policy applied when Retryable is true. NOTE: all attempts share Timeout of circuit breaker
+	Retry     RetryPolicy     `mapstructure:"retry"`
+	Transport TransportConfig `mapstructure:"transport"`
+	RateLimit RateLimitConfig `mapstructure:"ratelimit"`
+	Hedge     HedgeConfig     `mapstructure:"hedge"`
+	Cache     CacheConfig     `mapstructure:"cache"`
+	Fallback  FallbackConfig  `mapstructure:"fallback"`
+	LogBody   BodyLogConfig   `mapstructure:"logbody"`
 }
 
-// CircuitBreakerManager defines the basic configuration of Hystrix Circuit Breaker
+// CircuitBreakerManager defines the basic configuration of Circuit Breaker of each register
 type CircuitBreakerManager struct {
 	Register map[string]*circuitBreakerConfig `mapstructure:"registers"`
 	HTTPClient
 	RetryHTTPClient
+	breakers    map[string]circuitbreaker.CircuitBreaker
+	downstreams map[string]*downstream
 }
 
-func GetCircuitBreakerMgr() CircuitBreakerManager {
-	return instance
+// sender makes a single outbound request, it's implemented by HTTPClient and RetryHTTPClient
+type sender interface {
+	Send(ctx context.Context, r *Request) (*Response, error)
 }
 
-func initHystrixStreamServer() {
-	hystrixStreamHandler := hystrix.NewStreamHandler()
-	hystrixStreamHandler.Start()
-	go http.ListenAndServe(net.JoinHostPort("", "8092"), hystrixStreamHandler)
+func GetCircuitBreakerMgr() CircuitBreakerManager {
+	return instance
 }
 
-func InitCircuitBreakerMgr() {
+// InitCircuitBreakerMgr creates circuit breakers, connection pools and clients of registers of c
+func InitCircuitBreakerMgr(c CircuitBreakersConfig) {
 	once.Do(func() {
-		cbm := &CircuitBreakerManager{}
-		if err := configs.GetConfigUnmarshalKey("circuitbreaker", cbm); err != nil {
-			log.Fatalf("***** [INIT:CIRCUITBREAKER][FAIL] ***** Failed to init Circuit Breaker configuration:: %v ......", err)
+		cbm, err := newCircuitBreakerManager(c)
+		if err != nil {
+			logger.Fatalf("***** [INIT:CIRCUITBREAKER][FAIL] ***** %v ......", err)
 			os.Exit(1)
 		}
 
-		cbm.Register[DefaultHandler] = &circuitBreakerConfig{
-			Timeout:                defaultTimeout,
-			MaxConcurrentRequests:  defaultMaxConcurrent,
-			RequestVolumeThreshold: defaultVolumeThreshold,
-			SleepWindow:            defaultSleepWindow,
-			ErrorPercentThreshold:  defaultErrorPercentThreshold,
-			Retryable:              false,
+		registerCircuitBreakerMetrics(cbm.breakers)
+		instance = cbm
+		configs.Subscribe("circuitbreaker.registers", instance.reloadCircuitBreakers)
+		logger.Infof("***** [INIT:CIRCUITBREAKER] ***** Initialise circuit breaker manager with %d registers ......", len(instance.Register))
+	})
+}
+
+// newCircuitBreakerManager returns CircuitBreakerManager of registers of c and DefaultHandler
+func newCircuitBreakerManager(c CircuitBreakersConfig) (CircuitBreakerManager, error) {
+	// Registers are copied since defaults are filled in
+	registers := map[string]*circuitBreakerConfig{}
+	for r, rc := range c.Registers {
+		copied := *rc
+		registers[r] = &copied
+	}
+	// Keys of register are case-insensitive since viper lowercases keys of configuration
+	registers[strings.ToLower(DefaultHandler)] = &circuitBreakerConfig{
+		Config: circuitbreaker.Config{
+			Timeout:               defaultTimeout,
+			MaxConcurrentRequests: defaultMaxConcurrent,
+		},
+		Retryable: false,
+	}
+	breakers := map[string]circuitbreaker.CircuitBreaker{}
+	downstreams := map[string]*downstream{}
+	for r, c := range registers {
+		if err := c.validate(); err != nil {
+			return CircuitBreakerManager{}, fmt.Errorf("invalid configuration of register %s:: %w", r, err)
 		}
-		for r, c := range cbm.Register {
-			hystrix.ConfigureCommand(r, hystrix.CommandConfig{
-				Timeout:                c.Timeout,
-				MaxConcurrentRequests:  c.MaxConcurrentRequests,
-				RequestVolumeThreshold: c.RequestVolumeThreshold,
-				SleepWindow:            c.SleepWindow,
-				ErrorPercentThreshold:  c.ErrorPercentThreshold,
-			})
+		if f := c.Fallback; f.Type == FallbackCustom {
+			if _, ok := customFallback(f.Name); !ok {
+				return CircuitBreakerManager{}, fmt.Errorf("custom fallback %s of register %s isn't registered", f.Name, r)
+			}
 		}
+		c.Config = c.Config.WithDefaults()
+		c.Retry = c.Retry.WithDefaults()
+		c.Transport = c.Transport.WithDefaults()
+		c.Hedge = c.Hedge.WithDefaults()
+		c.LogBody = c.LogBody.WithDefaults()
+		breakers[r] = NewCircuitBreaker(r, c.Config)
+		downstreams[r] = newDownstream(c)
+	}
 
-		hc := InitHTTPClient()
-		rc := InitRetryClient()
-		initHystrixStreamServer()
-		instance = CircuitBreakerManager{cbm.Register, *hc, *rc}
-		log.Infof("***** [INIT:CIRCUITBREAKER] ***** Initialise circuit breaker manager with %d registers ......", len(instance.Register))
-	})
+	hc := InitHTTPClient()
+	rc := InitRetryClient()
+	return CircuitBreakerManager{registers, *hc, *rc, breakers, downstreams}, nil
 }
 
-// CBHTTPGet makes HTTP GET request with Hystrix circuit breaker
-func (cbm CircuitBreakerManager) CBHTTPGet(register, url, headers string, retryable bool) ([]byte, error) {
-	if _, ok := cbm.Register[register]; ok {
-		register = DefaultHandler
+// registerOf returns the configured register or DefaultHandler if register is not configured
+func (cbm CircuitBreakerManager) registerOf(register string) string {
+	if _, ok := cbm.Register[strings.ToLower(register)]; ok {
+		return strings.ToLower(register)
 	}
 
-	resTube := make(chan []byte, 1)
-	runFunc := cbm.runFuncGenerator("GET", url, headers, nil, retryable, resTube)
-	errTube := hystrix.Go(strings.ToLower(register), runFunc, fallbackFunc)
+	return strings.ToLower(DefaultHandler)
+}
 
-	select {
-	case res := <-resTube:
-		return res, nil
-	case err := <-errTube:
-		log.Errorf("***** [CIRCUITBREAKER][FAIL] ***** Error:: %#v", err.Error())
-		return nil, err
+// URLOf returns the URL of path on downstream of register, or on defaultBaseURL if register has no baseurl
+func (cbm CircuitBreakerManager) URLOf(register, path string) string {
+	base := cbm.Register[cbm.registerOf(register)].BaseURL
+	if base == "" {
+		base = defaultBaseURL
 	}
+	return strings.TrimSuffix(base, "/") + "/" + strings.TrimPrefix(path, "/")
 }
 
-// CBHTTPPost makes HTTP POST request with Hystrix circuit breaker
-func (cbm CircuitBreakerManager) CBHTTPPost(register, url, headers string, reqBody []byte) ([]byte, error) {
-	if _, ok := cbm.Register[register]; !ok {
-		register = DefaultHandler
+/*
+Do makes HTTP request of any method with circuit breaker of register. The response of any status code is
+returned, while a 5xx response is also reported as HTTPError and counted as failure by the circuit breaker. The
+in-flight request is cancelled when ctx is done or the circuit breaker times out. Idempotent reads are hedged if
+hedging of register is enabled. GET responses are cached if caching of register is enabled, and a cached response
+marked Stale may be returned when the circuit breaker is open. When the request fails for any reason other than
+cancellation of ctx, the fallback of register is served instead if it's configured, see Response.Fallback. Bodies
+are logged only if logbody of register is enabled.
+*/
+func (cbm CircuitBreakerManager) Do(ctx context.Context, register string, req *Request) (*Response, error) {
+	register = cbm.registerOf(register)
+	c := cbm.Register[register]
+	if !c.LogBody.Enabled {
+		return cbm.send(ctx, register, req, cbm.senderOf(register, c.Retryable && c.Retry.Allows(req.Method)))
 	}
 
-	resTube := make(chan []byte, 1)
-	retryable := cbm.Register[register].Retryable
-	runFunc := cbm.runFuncGenerator("POST", url, headers, reqBody, retryable, resTube)
+	reqBody := bufferBody(req)
+	res, err := cbm.send(ctx, register, req, cbm.senderOf(register, c.Retryable && c.Retry.Allows(req.Method)))
+	c.LogBody.logBodies(ctx, register, req, reqBody, res)
+	return res, err
+}
 
-	errTube := hystrix.Go(strings.ToLower(register), runFunc, fallbackFunc)
+// send hedges req if it's allowed by the hedging of register, otherwise makes a single attempt
+func (cbm CircuitBreakerManager) send(ctx context.Context, register string, req *Request, client sender) (*Response, error) {
+	var res *Response
+	var err error
+	if h := cbm.Register[register].Hedge; h.hedgeable(req) {
+		res, err = cbm.hedge(ctx, register, req, client, h)
+	} else {
+		res, err = cbm.do(ctx, register, req, client)
+	}
 
-	select {
-	case res := <-resTube:
-		return res, nil
-	case err := <-errTube:
-		log.Errorf("***** [CIRCUITBREAKER][FAIL] ***** Error:: %#v", err.Error())
-		return nil, err
+	if errors.Is(err, circuitbreaker.ErrOpen) {
+		if stale, ok := cbm.downstreams[register].stale(req); ok {
+			logger.WithContext(ctx).Warnf("***** [CIRCUITBREAKER] ***** [REGISTER:%s] [URL:%s] Serve stale response from cache", register, req.URL)
+			return stale, nil
+		}
+	}
+	if err != nil && ctx.Err() == nil {
+		if fb, ok := cbm.fallback(ctx, register, req, err); ok {
+			return fb, nil
+		}
 	}
+	return res, err
 }
 
-func (cbm CircuitBreakerManager) runFuncGenerator(method, url, headers string, reqBody []byte, retryable bool, resTube chan []byte) func() error {
+// senderOf returns the client of register applying its retry policy if retryable, or the plain client otherwise
+func (cbm CircuitBreakerManager) senderOf(register string, retryable bool) sender {
 	if retryable {
-		return cbm.retryableRunFunc(method, url, headers, reqBody, resTube)
+		return cbm.downstreams[register].retry
 	}
 
-	return cbm.cbRunFunc(method, url, headers, reqBody, resTube)
+	return cbm.downstreams[register].http
 }
 
-func (cbm CircuitBreakerManager) cbRunFunc(method, url, headers string, reqBody []byte, resTube chan []byte) func() error {
-	return func() error {
-		res, httpErr := cbm.HTTPClient.HTTPRequest(method, url, map[string]string{"Content-Type": headers}, reqBody)
-		if httpErr != nil {
-			// Return error to fallbackFunc
-			return httpErr
+func (cbm CircuitBreakerManager) do(ctx context.Context, register string, req *Request, client sender) (*Response, error) {
+	resTube := make(chan *Response, 1)
+	runFunc := cbm.runFuncGenerator(req, client, resTube)
+	start := time.Now()
+	ctx, span := tracing.Tracer().Start(ctx, "circuitbreaker "+register, trace.WithAttributes(
+		attribute.String("circuitbreaker.register", register),
+	))
+	defer span.End()
+
+	// Requests rejected by rate limiter never reach the circuit breaker, so they're not counted as failures
+	err := cbm.downstreams[register].wait(ctx)
+	if err == nil {
+		err = cbm.breakers[register].Execute(withRegister(ctx, register), runFunc, fallbackFunc)
+	}
+	observeRequest(register, start, err)
+	span.SetAttributes(attribute.String("circuitbreaker.outcome", outcomeOf(err)))
+
+	var res *Response
+	select {
+	case res = <-resTube:
+	default:
+	}
+	if err != nil {
+		// Cancellation by caller, e.g. the loser of hedged requests, isn't a failure of downstream
+		if ctx.Err() != nil {
+			logger.WithContext(ctx).Debugf("***** [CIRCUITBREAKER] ***** [REGISTER:%s] [METHOD:%s] [URL:%s] Cancelled:: %v", register, req.Method, req.URL, err)
+			return res, err
 		}
+		span.SetStatus(codes.Error, err.Error())
+		logger.WithContext(ctx).Errorf("***** [CIRCUITBREAKER][FAIL] ***** [REGISTER:%s] [METHOD:%s] [URL:%s] Error:: %v", register, req.Method, req.URL, err)
+		return res, err
+	}
 
-		resTube <- res
-		return nil
+	return res, nil
+}
+
+// CBHTTPGet makes HTTP GET request with circuit breaker
+func (cbm CircuitBreakerManager) CBHTTPGet(register, url, headers string, retryable bool) ([]byte, error) {
+	req := NewRequest(http.MethodGet, url, map[string]string{"Content-Type": headers}, nil)
+	register = cbm.registerOf(register)
+	res, err := cbm.send(context.Background(), register, req, cbm.senderOf(register, retryable))
+	if c := cbm.Register[register].LogBody; c.Enabled {
+		c.logBodies(context.Background(), register, req, nil, res)
 	}
+	return bodyOf(res, err)
 }
 
-func (cbm CircuitBreakerManager) retryableRunFunc(method, url, headers string, reqBody []byte, resTube chan []byte) func() error {
-	return func() error {
-		req, err := retryablehttp.NewRequest(method, url, reqBody)
-		if err != nil {
-			log.Errorf("***** [CIRCUITBREAKER][FAIL] ***** Cannot create request")
-			return nil
-		}
+// CBHTTPPost makes HTTP POST request with circuit breaker
+func (cbm CircuitBreakerManager) CBHTTPPost(register, url, headers string, reqBody []byte) ([]byte, error) {
+	req := NewRequest(http.MethodPost, url, map[string]string{"Content-Type": headers}, bytes.NewReader(reqBody))
+	return bodyOf(cbm.Do(context.Background(), register, req))
+}
 
-		req.Header.Set("Content-Type", headers)
-		res, httpErr := cbm.RetryHTTPClient.Do(req)
+/*
+bodyOf keeps the behaviour of CBHTTPGet and CBHTTPPost which only accept response of 200, except that the body of a
+fallback is returned with FallbackServed whatever its status code, e.g. the 503 of a static fallback.
+*/
+func bodyOf(res *Response, err error) ([]byte, error) {
+	if err != nil {
+		return nil, err
+	}
+	if res.Fallback != "" {
+		return res.Body, FallbackServed{res}
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, HTTPError{res.Status, res.StatusCode}
+	}
+
+	return res.Body, nil
+}
+
+func (cbm CircuitBreakerManager) runFuncGenerator(req *Request, client sender, resTube chan *Response) circuitbreaker.RunFunc {
+	return func(ctx context.Context) error {
+		res, httpErr := client.Send(ctx, req)
 		if httpErr != nil {
 			// Return error to fallbackFunc
 			return httpErr
 		}
-		if res.StatusCode != 200 {
-			return fmt.Errorf("***** [HTTP::ERROR] *****[Status:%s] [StatusCode:%d]", res.Status, res.StatusCode)
-		}
 
-		resBody, ioErr := ioutil.ReadAll(res.Body)
-		if ioErr != nil {
-			log.Errorf("***** HTTPPost::[FAIL] *****ReadAll Execution [Error:%v] ", ioErr)
-			return nil
+		resTube <- res
+		if res.StatusCode >= http.StatusInternalServerError {
+			return HTTPError{res.Status, res.StatusCode}
 		}
-
-		resTube <- resBody
 		return nil
 	}
 }
 
-func fallbackFunc(err error) error {
+func fallbackFunc(ctx context.Context, err error) error {
 	// Return error to errTube
 	return err
 }
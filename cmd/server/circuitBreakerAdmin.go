@@ -0,0 +1,208 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/linushung/artemis/internal/pkg/circuitbreaker"
+)
+
+var (
+	// ErrUnknownRegister returns when the register isn't configured in circuit breaker manager
+	ErrUnknownRegister = errors.New("unknown register")
+	// ErrNotControllable returns when the circuit breaker implementation doesn't support manual control
+	ErrNotControllable = errors.New("circuit breaker is not controllable")
+)
+
+// CircuitBreakerStatus represents the live configuration and state of the circuit breaker of a register
+type CircuitBreakerStatus struct {
+	Register     string                `json:"register"`
+	BaseURL      string                `json:"baseURL"`
+	State        string                `json:"state"`
+	Forced       bool                  `json:"forced"`
+	InFlight     int                   `json:"inFlight"`
+	Queued       int                   `json:"queued"`
+	Retryable    bool                  `json:"retryable"`
+	Retry        RetryPolicy           `json:"retry"`
+	Transport    TransportConfig       `json:"transport"`
+	RateLimit    RateLimitConfig       `json:"rateLimit"`
+	Hedge        HedgeConfig           `json:"hedge"`
+	Cache        CacheConfig           `json:"cache"`
+	CachedURLs   int                   `json:"cachedURLs"`
+	Fallback     FallbackConfig        `json:"fallback"`
+	LogBody      BodyLogConfig         `json:"logBody"`
+	Config       circuitbreaker.Config `json:"config"`
+	Controllable bool                  `json:"controllable"`
+}
+
+// CircuitBreakers returns status of circuit breakers of all registers ordered by name
+func (cbm CircuitBreakerManager) CircuitBreakers() []CircuitBreakerStatus {
+	status := make([]CircuitBreakerStatus, 0, len(cbm.breakers))
+	for register := range cbm.breakers {
+		s, _ := cbm.CircuitBreaker(register)
+		status = append(status, s)
+	}
+
+	sort.Slice(status, func(i, j int) bool { return status[i].Register < status[j].Register })
+	return status
+}
+
+// CircuitBreaker returns status of the circuit breaker of register
+func (cbm CircuitBreakerManager) CircuitBreaker(register string) (CircuitBreakerStatus, error) {
+	register = strings.ToLower(register)
+	b, ok := cbm.breakers[register]
+	if !ok {
+		return CircuitBreakerStatus{}, ErrUnknownRegister
+	}
+
+	inFlight, _ := b.Concurrency()
+	queued, _ := b.Queued()
+	s := CircuitBreakerStatus{
+		Register:  register,
+		BaseURL:   cbm.Register[register].BaseURL,
+		State:     b.State().String(),
+		InFlight:  inFlight,
+		Queued:    queued,
+		Retryable: cbm.Register[register].Retryable,
+		Retry:     cbm.Register[register].Retry,
+		Transport: cbm.Register[register].Transport,
+		RateLimit: cbm.Register[register].RateLimit,
+		Hedge:     cbm.Register[register].Hedge,
+		Cache:     cbm.Register[register].Cache,
+		Fallback:  cbm.Register[register].Fallback,
+		LogBody:   cbm.Register[register].LogBody,
+		Config:    cbm.thresholdsOf(register),
+	}
+	if d := cbm.downstreams[register]; d.cache != nil {
+		s.CachedURLs = d.cache.Len()
+	}
+	if c, ok := b.(circuitbreaker.Controller); ok {
+		s.Controllable = true
+		s.Forced = c.Forced()
+		s.Config = c.Config()
+	}
+	return s, nil
+}
+
+func (cbm CircuitBreakerManager) controllerOf(register string) (circuitbreaker.Controller, error) {
+	b, ok := cbm.breakers[strings.ToLower(register)]
+	if !ok {
+		return nil, ErrUnknownRegister
+	}
+	c, ok := b.(circuitbreaker.Controller)
+	if !ok {
+		return nil, ErrNotControllable
+	}
+
+	return c, nil
+}
+
+// ForceCircuitBreaker pins the circuit breaker of register in Open or Closed state
+func (cbm CircuitBreakerManager) ForceCircuitBreaker(register string, state circuitbreaker.State, operator string) error {
+	c, err := cbm.controllerOf(register)
+	if err != nil {
+		return err
+	}
+
+	logger.Warnf("***** [CIRCUITBREAKER:%s][ADMIN] ***** %s forces state to %s", register, operator, state)
+	return c.Force(state)
+}
+
+// ReleaseCircuitBreaker lets the circuit breaker of register change state by its statistics again
+func (cbm CircuitBreakerManager) ReleaseCircuitBreaker(register, operator string) error {
+	c, err := cbm.controllerOf(register)
+	if err != nil {
+		return err
+	}
+
+	logger.Warnf("***** [CIRCUITBREAKER:%s][ADMIN] ***** %s releases forced state", register, operator)
+	c.Release()
+	return nil
+}
+
+// ResetCircuitBreaker clears statistics and override of the circuit breaker of register
+func (cbm CircuitBreakerManager) ResetCircuitBreaker(register, operator string) error {
+	c, err := cbm.controllerOf(register)
+	if err != nil {
+		return err
+	}
+
+	logger.Warnf("***** [CIRCUITBREAKER:%s][ADMIN] ***** %s resets statistics", register, operator)
+	c.Reset()
+	return nil
+}
+
+/*
+CircuitBreakerConfigUpdate represents thresholds changed by operator at runtime. Fields which are absent keep their
+current values, 0 restores the default value or disables queueing for MaxQueue.
+*/
+type CircuitBreakerConfigUpdate struct {
+	Timeout                *int `json:"timeout"`
+	MaxConcurrentRequests  *int `json:"maxConcurrentRequests"`
+	RequestVolumeThreshold *int `json:"requestVolumeThreshold"`
+	SleepWindow            *int `json:"sleepWindow"`
+	ErrorPercentThreshold  *int `json:"errorPercentThreshold"`
+	HalfOpenProbes         *int `json:"halfOpenProbes"`
+	RollingWindow          *int `json:"rollingWindow"`
+	MaxQueue               *int `json:"maxQueue"`
+	QueueTimeout           *int `json:"queueTimeout"`
+}
+
+func (u CircuitBreakerConfigUpdate) validate() error {
+	fields := []struct {
+		key string
+		v   *int
+	}{
+		{"timeout", u.Timeout},
+		{"maxconcurrentrequests", u.MaxConcurrentRequests},
+		{"requestvolumethreshold", u.RequestVolumeThreshold},
+		{"sleepwindow", u.SleepWindow},
+		{"errorpercentthreshold", u.ErrorPercentThreshold},
+		{"halfopenprobes", u.HalfOpenProbes},
+		{"rollingwindow", u.RollingWindow},
+		{"maxqueue", u.MaxQueue},
+		{"queuetimeout", u.QueueTimeout},
+	}
+	for _, f := range fields {
+		if f.v != nil && *f.v < 0 {
+			return fmt.Errorf("%s must not be negative: %d", f.key, *f.v)
+		}
+	}
+	if u.ErrorPercentThreshold != nil && *u.ErrorPercentThreshold > 100 {
+		return fmt.Errorf("errorpercentthreshold must not exceed 100: %d", *u.ErrorPercentThreshold)
+	}
+	return nil
+}
+
+// ConfigureCircuitBreaker changes thresholds of the circuit breaker of register at runtime
+func (cbm CircuitBreakerManager) ConfigureCircuitBreaker(register string, config CircuitBreakerConfigUpdate, operator string) (circuitbreaker.Config, error) {
+	c, err := cbm.controllerOf(register)
+	if err != nil {
+		return circuitbreaker.Config{}, err
+	}
+	if err := config.validate(); err != nil {
+		return circuitbreaker.Config{}, err
+	}
+
+	merged := c.Config()
+	override := func(v *int, n *int) {
+		if n != nil {
+			*v = *n
+		}
+	}
+	override(&merged.Timeout, config.Timeout)
+	override(&merged.MaxConcurrentRequests, config.MaxConcurrentRequests)
+	override(&merged.RequestVolumeThreshold, config.RequestVolumeThreshold)
+	override(&merged.SleepWindow, config.SleepWindow)
+	override(&merged.ErrorPercentThreshold, config.ErrorPercentThreshold)
+	override(&merged.HalfOpenProbes, config.HalfOpenProbes)
+	override(&merged.RollingWindow, config.RollingWindow)
+	override(&merged.MaxQueue, config.MaxQueue)
+	override(&merged.QueueTimeout, config.QueueTimeout)
+
+	logger.Warnf("***** [CIRCUITBREAKER:%s][ADMIN] ***** %s changes configuration to %+v", register, operator, merged)
+	c.Configure(merged)
+	return c.Config(), nil
+}
@@ -0,0 +1,52 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/linushung/artemis/internal/pkg/circuitbreaker"
+)
+
+func intOf(n int) *int { return &n }
+
+func TestConfigureCircuitBreaker(t *testing.T) {
+	const register = "bulkhead"
+	cbm := newTestManager(t, register, circuitBreakerConfig{Config: circuitbreaker.Config{
+		Timeout:               500,
+		MaxConcurrentRequests: 2,
+		ErrorPercentThreshold: 30,
+		MaxQueue:              4,
+		QueueTimeout:          200,
+	}})
+
+	tests := []struct {
+		name   string
+		update CircuitBreakerConfigUpdate
+		valid  bool
+		check  func(c circuitbreaker.Config) bool
+	}{
+		{"absent fields are kept", CircuitBreakerConfigUpdate{Timeout: intOf(800)}, true, func(c circuitbreaker.Config) bool {
+			return c.Timeout == 800 && c.MaxQueue == 4 && c.QueueTimeout == 200 && c.ErrorPercentThreshold == 30
+		}},
+		{"queue is disabled", CircuitBreakerConfigUpdate{MaxQueue: intOf(0), QueueTimeout: intOf(0)}, true, func(c circuitbreaker.Config) bool {
+			return c.MaxQueue == 0 && c.QueueTimeout == 0 && c.Timeout == 800
+		}},
+		{"zero restores default", CircuitBreakerConfigUpdate{ErrorPercentThreshold: intOf(0)}, true, func(c circuitbreaker.Config) bool {
+			return c.ErrorPercentThreshold == circuitbreaker.DefaultErrorPercentThreshold
+		}},
+		{"negative", CircuitBreakerConfigUpdate{MaxQueue: intOf(-1)}, false, nil},
+		{"error percent over 100", CircuitBreakerConfigUpdate{ErrorPercentThreshold: intOf(101)}, false, nil},
+	}
+	for _, tt := range tests {
+		c, err := cbm.ConfigureCircuitBreaker(register, tt.update, "jake")
+		if (err == nil) != tt.valid {
+			t.Fatalf("%s: ConfigureCircuitBreaker = %v, want valid %v", tt.name, err, tt.valid)
+		}
+		if tt.check != nil && !tt.check(c) {
+			t.Errorf("%s: config = %+v", tt.name, c)
+		}
+	}
+
+	if _, err := cbm.ConfigureCircuitBreaker("unknown", CircuitBreakerConfigUpdate{}, "jake"); err != ErrUnknownRegister {
+		t.Errorf("ConfigureCircuitBreaker of unknown register = %v, want %v", err, ErrUnknownRegister)
+	}
+}
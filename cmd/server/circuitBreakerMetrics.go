@@ -0,0 +1,171 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	rhttp "github.com/hashicorp/go-retryablehttp"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/linushung/artemis/internal/pkg/circuitbreaker"
+)
+
+/* Ref: https://prometheus.io/docs/practices/naming/ */
+const (
+	metricsNamespace = "artemis"
+	metricsSubsystem = "circuitbreaker"
+)
+
+// Outcomes of an outbound request through circuit breaker
+const (
+	outcomeSuccess        = "success"
+	outcomeFailure        = "failure"
+	outcomeTimeout        = "timeout"
+	outcomeShortCircuited = "short_circuited"
+	outcomeRejected       = "rejected"
+	outcomeRateLimited    = "rate_limited"
+	outcomeCanceled       = "canceled"
+)
+
+var (
+	cbRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: metricsSubsystem,
+		Name:      "requests_total",
+		Help:      "Number of outbound requests by register and outcome.",
+	}, []string{"register", "outcome"})
+	cbLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Subsystem: metricsSubsystem,
+		Name:      "request_duration_seconds",
+		Help:      "Latency of outbound requests by register and outcome.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"register", "outcome"})
+	cbRetries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: metricsSubsystem,
+		Name:      "retry_attempts_total",
+		Help:      "Number of retry attempts made by RetryHTTPClient by register.",
+	}, []string{"register"})
+	cbHedges = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: metricsSubsystem,
+		Name:      "hedged_attempts_total",
+		Help:      "Number of hedged attempts sent in parallel to a slow request by register.",
+	}, []string{"register"})
+	cbFallbacks = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: metricsSubsystem,
+		Name:      "fallbacks_total",
+		Help:      "Number of fallback responses served instead of failed requests by register and type.",
+	}, []string{"register", "type"})
+
+	cbStateDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, metricsSubsystem, "state"),
+		"State of circuit breaker by register (0: closed, 1: half-open, 2: open).",
+		[]string{"register"}, nil,
+	)
+	cbConcurrencyDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, metricsSubsystem, "concurrent_requests"),
+		"Number of outbound requests in flight by register.",
+		[]string{"register"}, nil,
+	)
+	cbForcedDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, metricsSubsystem, "forced"),
+		"Whether the state of circuit breaker is forced by operator (1) or not (0) by register.",
+		[]string{"register"}, nil,
+	)
+	cbMaxConcurrencyDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, metricsSubsystem, "max_concurrent_requests"),
+		"Maximum number of outbound requests in flight allowed by register.",
+		[]string{"register"}, nil,
+	)
+	cbQueuedDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, metricsSubsystem, "queued_requests"),
+		"Number of outbound requests waiting for a free slot of bulkhead by register.",
+		[]string{"register"}, nil,
+	)
+)
+
+// circuitBreakerCollector reads state and concurrency of breakers when Prometheus scrapes
+type circuitBreakerCollector struct {
+	breakers map[string]circuitbreaker.CircuitBreaker
+}
+
+func (c circuitBreakerCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- cbStateDesc
+	ch <- cbForcedDesc
+	ch <- cbConcurrencyDesc
+	ch <- cbMaxConcurrencyDesc
+	ch <- cbQueuedDesc
+}
+
+func (c circuitBreakerCollector) Collect(ch chan<- prometheus.Metric) {
+	for register, b := range c.breakers {
+		inUse, max := b.Concurrency()
+		ch <- prometheus.MustNewConstMetric(cbStateDesc, prometheus.GaugeValue, float64(b.State()), register)
+		ch <- prometheus.MustNewConstMetric(cbConcurrencyDesc, prometheus.GaugeValue, float64(inUse), register)
+		ch <- prometheus.MustNewConstMetric(cbMaxConcurrencyDesc, prometheus.GaugeValue, float64(max), register)
+		queued, _ := b.Queued()
+		ch <- prometheus.MustNewConstMetric(cbQueuedDesc, prometheus.GaugeValue, float64(queued), register)
+		if ctl, ok := b.(circuitbreaker.Controller); ok {
+			forced := 0.0
+			if ctl.Forced() {
+				forced = 1
+			}
+			ch <- prometheus.MustNewConstMetric(cbForcedDesc, prometheus.GaugeValue, forced, register)
+		}
+	}
+}
+
+func registerCircuitBreakerMetrics(breakers map[string]circuitbreaker.CircuitBreaker) {
+	prometheus.MustRegister(cbRequests, cbLatency, cbRetries, cbHedges, cbFallbacks, circuitBreakerCollector{breakers})
+}
+
+// outcomeOf classifies the error returned by circuit breaker
+func outcomeOf(err error) string {
+	switch {
+	case err == nil:
+		return outcomeSuccess
+	case errors.Is(err, circuitbreaker.ErrOpen):
+		return outcomeShortCircuited
+	case errors.Is(err, circuitbreaker.ErrMaxConcurrency):
+		return outcomeRejected
+	case errors.Is(err, ErrRateLimited):
+		return outcomeRateLimited
+	case errors.Is(err, circuitbreaker.ErrTimeout):
+		return outcomeTimeout
+	case errors.Is(err, context.Canceled):
+		return outcomeCanceled
+	default:
+		return outcomeFailure
+	}
+}
+
+func observeRequest(register string, start time.Time, err error) {
+	outcome := outcomeOf(err)
+	cbRequests.WithLabelValues(register, outcome).Inc()
+	cbLatency.WithLabelValues(register, outcome).Observe(time.Since(start).Seconds())
+}
+
+type registerKey struct{}
+
+// withRegister binds register to the context of outbound request for labeling metrics of retries
+func withRegister(ctx context.Context, register string) context.Context {
+	return context.WithValue(ctx, registerKey{}, register)
+}
+
+// retryMetricsHook counts retry attempts of RetryHTTPClient, attempt 0 is the initial request
+func retryMetricsHook(_ rhttp.Logger, req *http.Request, attempt int) {
+	if attempt == 0 {
+		return
+	}
+
+	register, ok := req.Context().Value(registerKey{}).(string)
+	if !ok {
+		register = "unknown"
+	}
+	cbRetries.WithLabelValues(register).Inc()
+}
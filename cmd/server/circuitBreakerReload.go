@@ -0,0 +1,104 @@
+package server
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/linushung/artemis/internal/pkg/circuitbreaker"
+	"github.com/linushung/artemis/internal/pkg/configs"
+)
+
+/*
+Hot reload of circuit breakers:
+1. Changes are validated with the whole configuration before they're applied, see WatchConfig.
+2. Thresholds of existing registers (timeout, maxconcurrentrequests, errorpercentthreshold, ...) are applied to their
+circuit breakers at once, overriding changes made by admin API.
+3. Other changes, e.g. new registers, retry, transport or ratelimit, take effect after restart.
+*/
+
+func (c *circuitBreakerConfig) validate() error {
+	if err := c.Fallback.validate(); err != nil {
+		return err
+	}
+	if err := c.Retry.validate(); err != nil {
+		return err
+	}
+	if c.ErrorPercentThreshold > 100 {
+		return fmt.Errorf("errorpercentthreshold must not exceed 100: %d", c.ErrorPercentThreshold)
+	}
+	return nil
+}
+
+func registersOf(c configs.Config) (map[string]*circuitBreakerConfig, error) {
+	cfg, err := LoadConfig(c)
+	if err != nil {
+		return nil, err
+	}
+	return cfg.CircuitBreaker.Registers, nil
+}
+
+// thresholdsMu guards circuitbreaker.Config of registers, which is replaced by reloadCircuitBreakers at runtime
+var thresholdsMu sync.RWMutex
+
+// thresholdsOf returns the configured thresholds of register
+func (cbm CircuitBreakerManager) thresholdsOf(register string) circuitbreaker.Config {
+	thresholdsMu.RLock()
+	defer thresholdsMu.RUnlock()
+	return cbm.Register[register].Config
+}
+
+/*
+reloadCircuitBreakers applies changed thresholds of registers to their circuit breakers and Register, so admin API
+reports them as configured thresholds.
+*/
+func (cbm CircuitBreakerManager) reloadCircuitBreakers(old, new configs.Config) error {
+	previous, err := registersOf(old)
+	if err != nil {
+		previous = map[string]*circuitBreakerConfig{}
+	}
+	registers, err := registersOf(new)
+	if err != nil {
+		return err
+	}
+
+	for r, c := range registers {
+		p, ok := previous[r]
+		if ok && reflect.DeepEqual(p, c) {
+			continue
+		}
+		if _, exist := cbm.breakers[r]; !exist {
+			logger.Warnf("***** [CIRCUITBREAKER:%s] ***** New register takes effect after restart", r)
+			continue
+		}
+
+		if ok {
+			a, b := *p, *c
+			a.Config, b.Config = c.Config, c.Config
+			if !reflect.DeepEqual(a, b) {
+				logger.Warnf("***** [CIRCUITBREAKER:%s] ***** Changes other than thresholds take effect after restart", r)
+			}
+			if reflect.DeepEqual(p.Config, c.Config) {
+				continue
+			}
+		}
+
+		controller, err := cbm.controllerOf(r)
+		if err != nil {
+			logger.Errorf("***** [CIRCUITBREAKER:%s][FAIL] ***** Failed to reload configuration:: %v", r, err)
+			continue
+		}
+		thresholds := c.Config.WithDefaults()
+		controller.Configure(thresholds)
+		thresholdsMu.Lock()
+		cbm.Register[r].Config = thresholds
+		thresholdsMu.Unlock()
+	}
+
+	for r := range previous {
+		if _, ok := registers[r]; !ok {
+			logger.Warnf("***** [CIRCUITBREAKER:%s] ***** Removed register takes effect after restart", r)
+		}
+	}
+	return nil
+}
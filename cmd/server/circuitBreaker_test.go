@@ -0,0 +1,209 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/linushung/artemis/internal/pkg/circuitbreaker"
+	"github.com/linushung/artemis/internal/pkg/stub"
+)
+
+func TestBodyOf(t *testing.T) {
+	errDownstream := errors.New("downstream failure")
+	fallback := &Response{StatusCode: http.StatusServiceUnavailable, Body: []byte("later"), Fallback: FallbackStatic}
+	tests := []struct {
+		name    string
+		res     *Response
+		err     error
+		body    string
+		wantErr error
+	}{
+		{"ok", &Response{StatusCode: http.StatusOK, Body: []byte("ok")}, nil, "ok", nil},
+		{"error", nil, errDownstream, "", errDownstream},
+		{"not ok", &Response{StatusCode: http.StatusNotFound, Status: "404 Not Found"}, nil, "", HTTPError{"404 Not Found", http.StatusNotFound}},
+		{"static fallback", fallback, nil, "later", FallbackServed{fallback}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, err := bodyOf(tt.res, tt.err)
+			if string(body) != tt.body || !errors.Is(err, tt.wantErr) {
+				t.Errorf("bodyOf = %q, %v, want %q, %v", body, err, tt.body, tt.wantErr)
+			}
+		})
+	}
+}
+
+// newTestManager returns CircuitBreakerManager of register whose downstream is a stub server
+func newTestManager(t *testing.T, register string, c circuitBreakerConfig) CircuitBreakerManager {
+	t.Helper()
+	srv := stub.NewTestServer()
+	t.Cleanup(srv.Close)
+
+	c.BaseURL = srv.URL
+	cbm, err := newCircuitBreakerManager(CircuitBreakersConfig{Registers: map[string]*circuitBreakerConfig{register: &c}})
+	if err != nil {
+		t.Fatalf("newCircuitBreakerManager:: %v", err)
+	}
+	return cbm
+}
+
+func do(cbm CircuitBreakerManager, register, method, path string) (*Response, error) {
+	req := NewRequest(method, cbm.URLOf(register, path), nil, nil)
+	return cbm.Do(context.Background(), register, req)
+}
+
+func post(cbm CircuitBreakerManager, register, path string) (*Response, error) {
+	return do(cbm, register, http.MethodPost, path)
+}
+
+func TestCircuitBreakerOpensAndRecovers(t *testing.T) {
+	const register = "status"
+	cbm := newTestManager(t, register, circuitBreakerConfig{Config: circuitbreaker.Config{
+		RequestVolumeThreshold: 3,
+		ErrorPercentThreshold:  50,
+		SleepWindow:            100,
+		HalfOpenProbes:         1,
+	}})
+
+	for i := 0; i < 3; i++ {
+		res, err := post(cbm, register, "/status/500")
+		var httpErr HTTPError
+		if !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusInternalServerError || res.StatusCode != http.StatusInternalServerError {
+			t.Fatalf("request %d to /status/500 = %v, want HTTPError of 500", i, err)
+		}
+	}
+	if s := cbm.breakers[register].State(); s != circuitbreaker.Open {
+		t.Fatalf("state after 3 failures = %s, want %s", s, circuitbreaker.Open)
+	}
+	if _, err := post(cbm, register, "/status/200"); !errors.Is(err, circuitbreaker.ErrOpen) {
+		t.Fatalf("request of open breaker = %v, want %v", err, circuitbreaker.ErrOpen)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if s := cbm.breakers[register].State(); s != circuitbreaker.HalfOpen {
+		t.Fatalf("state after sleep window = %s, want %s", s, circuitbreaker.HalfOpen)
+	}
+	if res, err := post(cbm, register, "/status/200"); err != nil || res.StatusCode != http.StatusOK {
+		t.Fatalf("probe to /status/200 = %v, want 200", err)
+	}
+	if s := cbm.breakers[register].State(); s != circuitbreaker.Closed {
+		t.Fatalf("state after successful probe = %s, want %s", s, circuitbreaker.Closed)
+	}
+}
+
+func TestCircuitBreakerTimeout(t *testing.T) {
+	const register = "delay"
+	cbm := newTestManager(t, register, circuitBreakerConfig{Config: circuitbreaker.Config{Timeout: 100}})
+
+	start := time.Now()
+	if _, err := post(cbm, register, "/delay/5"); !errors.Is(err, circuitbreaker.ErrTimeout) {
+		t.Fatalf("request to /delay/5 = %v, want %v", err, circuitbreaker.ErrTimeout)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("request timed out after %s, want about 100ms", elapsed)
+	}
+	if res, err := post(cbm, register, "/delay/0"); err != nil || res.StatusCode != http.StatusOK {
+		t.Fatalf("request to /delay/0 = %v, want 200", err)
+	}
+}
+
+func TestCircuitBreakerRetries(t *testing.T) {
+	const register = "flaky"
+	cbm := newTestManager(t, register, circuitBreakerConfig{
+		Config:    circuitbreaker.Config{RequestVolumeThreshold: 100},
+		Retryable: true,
+		Retry:     RetryPolicy{MaxAttempts: 3, Backoff: BackoffConstant, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond},
+	})
+	retries := func() float64 { return testutil.ToFloat64(cbRetries.WithLabelValues(register)) }
+
+	// Attempts are exhausted and the last response is returned
+	before := retries()
+	res, err := do(cbm, register, http.MethodGet, "/flaky?failure=1&status=503")
+	var httpErr HTTPError
+	if !errors.As(err, &httpErr) || res.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("request to always failing /flaky = %v, want HTTPError of 503", err)
+	}
+	if n := retries() - before; n != 2 {
+		t.Errorf("retries of 3 attempts = %v, want 2", n)
+	}
+
+	before = retries()
+	if res, err := do(cbm, register, http.MethodGet, "/flaky?failure=0"); err != nil || res.StatusCode != http.StatusOK {
+		t.Fatalf("request to never failing /flaky = %v, want 200", err)
+	}
+	if n := retries() - before; n != 0 {
+		t.Errorf("retries of successful request = %v, want 0", n)
+	}
+
+	// Non-idempotent requests aren't retried unless the policy allows it
+	before = retries()
+	post(cbm, register, "/flaky?failure=1")
+	if n := retries() - before; n != 0 {
+		t.Errorf("retries of POST = %v, want 0", n)
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	const register = "limited"
+	const maxWait = 50 * time.Millisecond
+	cbm := newTestManager(t, register, circuitBreakerConfig{
+		Config:    circuitbreaker.Config{RequestVolumeThreshold: 2, ErrorPercentThreshold: 1},
+		RateLimit: RateLimitConfig{Rate: 1, Burst: 1, MaxWait: maxWait},
+	})
+	requests := func(outcome string) float64 {
+		return testutil.ToFloat64(cbRequests.WithLabelValues(register, outcome))
+	}
+
+	if res, err := post(cbm, register, "/status/200"); err != nil || res.StatusCode != http.StatusOK {
+		t.Fatalf("request within limit = %v, want 200", err)
+	}
+
+	// The next token is a second away, so requests over the limit are rejected without waiting it out
+	limited, failures := requests(outcomeRateLimited), requests(outcomeFailure)
+	for i := 0; i < 3; i++ {
+		start := time.Now()
+		if _, err := post(cbm, register, "/status/200"); !errors.Is(err, ErrRateLimited) {
+			t.Fatalf("request %d over limit = %v, want %v", i, err, ErrRateLimited)
+		}
+		if elapsed := time.Since(start); elapsed > maxWait+50*time.Millisecond {
+			t.Errorf("request %d is rejected after %s, want within maxwait %s", i, elapsed, maxWait)
+		}
+	}
+	if n := requests(outcomeRateLimited) - limited; n != 3 {
+		t.Errorf("rate limited requests = %v, want 3", n)
+	}
+	if n := requests(outcomeFailure) - failures; n != 0 {
+		t.Errorf("failures of rate limited requests = %v, want 0", n)
+	}
+	if s := cbm.breakers[register].State(); s != circuitbreaker.Closed {
+		t.Errorf("state after rate limited requests = %s, want %s", s, circuitbreaker.Closed)
+	}
+}
+
+func TestURLOf(t *testing.T) {
+	cbm, err := newCircuitBreakerManager(CircuitBreakersConfig{Registers: map[string]*circuitBreakerConfig{
+		"partner": {BaseURL: "http://partner.local/api/"},
+	}})
+	if err != nil {
+		t.Fatalf("newCircuitBreakerManager:: %v", err)
+	}
+
+	tests := []struct {
+		register, path, want string
+	}{
+		{"partner", "/status/200", "http://partner.local/api/status/200"},
+		{"Partner", "status/200", "http://partner.local/api/status/200"},
+		{"unknown", "/status/200", defaultBaseURL + "/status/200"},
+		{DefaultHandler, "/get", defaultBaseURL + "/get"},
+	}
+	for _, tt := range tests {
+		if got := cbm.URLOf(tt.register, tt.path); got != tt.want {
+			t.Errorf("URLOf(%q, %q) = %q, want %q", tt.register, tt.path, got, tt.want)
+		}
+	}
+}
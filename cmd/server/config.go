@@ -0,0 +1,204 @@
+package server
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/linushung/artemis/internal/app/authorization"
+	"github.com/linushung/artemis/internal/app/database/postgres"
+	"github.com/linushung/artemis/internal/pkg/configs"
+	"github.com/linushung/artemis/internal/pkg/faults"
+	"github.com/linushung/artemis/internal/pkg/logging"
+	"github.com/linushung/artemis/internal/pkg/tracing"
+)
+
+const (
+	defaultRESTPort = 8080
+	// defaultShutdownDrain is how long not-ready is reported before the server stops accepting connections
+	defaultShutdownDrain   = 5 * time.Second
+	defaultShutdownTimeout = 10 * time.Second
+	maxPort                = 65535
+)
+
+/*
+Config is the typed configuration of Artemis. It's loaded once at startup by LoadConfig and injected into subsystems,
+so unknown keys, values of wrong types and invalid values fail the startup with all errors at once instead of
+subsystems reading zero values of mistyped keys.
+*/
+type Config struct {
+	Service        ServiceConfig         `mapstructure:"service"`
+	Logging        logging.Config        `mapstructure:"logging"`
+	Health         HealthConfig          `mapstructure:"health"`
+	Connection     ConnectionConfig      `mapstructure:"connection"`
+	Auth           authorization.Config  `mapstructure:"auth"`
+	CircuitBreaker CircuitBreakersConfig `mapstructure:"circuitbreaker"`
+	Tracing        tracing.Config        `mapstructure:"tracing"`
+	FaultInjection faults.Config         `mapstructure:"faultinjection"`
+}
+
+// ServiceConfig represents "service"
+type ServiceConfig struct {
+	REST ListenConfig `mapstructure:"rest"`
+	// Metrics serves /metrics on a separate port, or on port of REST API if its port is 0 or the same
+	Metrics  ListenConfig   `mapstructure:"metrics"`
+	Shutdown ShutdownConfig `mapstructure:"shutdown"`
+}
+
+// ListenConfig represents the port a server listens on
+type ListenConfig struct {
+	Port int `mapstructure:"port"`
+}
+
+// Addr returns the address of Port on all interfaces, e.g. ":8080"
+func (c ListenConfig) Addr() string {
+	return fmt.Sprintf(":%d", c.Port)
+}
+
+/*
+ShutdownConfig represents "service.shutdown". On SIGTERM, not-ready is reported for Drain, so load balancers stop
+routing new requests to Artemis, then in-flight requests are waited for at most Timeout.
+*/
+type ShutdownConfig struct {
+	Drain   time.Duration `mapstructure:"drain"`
+	Timeout time.Duration `mapstructure:"timeout"`
+}
+
+// HealthConfig represents "health", see NewReadiness
+type HealthConfig struct {
+	// Timeout of each readiness check and CacheTTL of the readiness report, defaults of package health if 0
+	Timeout  time.Duration `mapstructure:"timeout"`
+	CacheTTL time.Duration `mapstructure:"cachettl"`
+	// PoolSaturation is the ratio of connections in use to maxopenconns at which the pool is saturated
+	PoolSaturation float64 `mapstructure:"poolsaturation"`
+	// CriticalRegisters fail readiness if any of their circuit breakers is open
+	CriticalRegisters []string `mapstructure:"criticalregisters"`
+}
+
+// ConnectionConfig represents "connection"
+type ConnectionConfig struct {
+	RDB postgres.Config `mapstructure:"rdb"`
+	// Logstash is replaced by "logging.sinks", Host is shipped JSON over UDP if no sinks are configured
+	Logstash struct {
+		Host string `mapstructure:"host"`
+	} `mapstructure:"logstash"`
+}
+
+// CircuitBreakersConfig represents "circuitbreaker", registers are keyed by lowercase names
+type CircuitBreakersConfig struct {
+	Registers map[string]*circuitBreakerConfig `mapstructure:"registers"`
+}
+
+// defaultConfig returns Config of default values, which are kept for keys not set in configuration
+func defaultConfig() *Config {
+	return &Config{
+		Service: ServiceConfig{
+			REST:     ListenConfig{Port: defaultRESTPort},
+			Shutdown: ShutdownConfig{Drain: defaultShutdownDrain, Timeout: defaultShutdownTimeout},
+		},
+		Health:     HealthConfig{PoolSaturation: defaultPoolSaturation},
+		Connection: ConnectionConfig{RDB: postgres.DefaultConfig()},
+		Auth:       authorization.DefaultConfig(),
+		Tracing:    tracing.DefaultConfig(),
+	}
+}
+
+/*
+LoadConfig decodes c into Config and validates it, errors of all keys are aggregated into configs.Errors. It's called
+at startup with configs.Current(), and with candidates of hot reload by WatchConfig.
+*/
+func LoadConfig(c configs.Config) (*Config, error) {
+	cfg := defaultConfig()
+	if err := c.Unmarshal(cfg); err != nil {
+		return nil, fmt.Errorf("cannot decode configuration:: %w", err)
+	}
+	if host := cfg.Connection.Logstash.Host; host != "" && len(cfg.Logging.Sinks) == 0 {
+		// Keep "connection.logstash.host" working as JSON to stdout and logstash over UDP
+		cfg.Logging.Sinks = []logging.SinkConfig{
+			{Type: logging.SinkStdout},
+			{Type: logging.SinkLogstash, Network: "udp", Address: host},
+		}
+	}
+
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func (c *Config) validate() error {
+	var errs configs.Errors
+	validPort := func(key string, port int, optional bool) {
+		if (port == 0 && !optional) || port < 0 || port > maxPort {
+			errs.Addf(key, "must be a port between 1 and %d, got %d", maxPort, port)
+		}
+	}
+	validPort("service.rest.port", c.Service.REST.Port, false)
+	validPort("service.metrics.port", c.Service.Metrics.Port, true)
+	if c.Service.Shutdown.Drain < 0 {
+		errs.Addf("service.shutdown.drain", "must not be negative, got %s", c.Service.Shutdown.Drain)
+	}
+	if c.Service.Shutdown.Timeout <= 0 {
+		errs.Addf("service.shutdown.timeout", "must be positive, got %s", c.Service.Shutdown.Timeout)
+	}
+
+	errs.Add("logging", c.Logging.Validate())
+
+	if c.Health.Timeout < 0 {
+		errs.Addf("health.timeout", "must not be negative, got %s", c.Health.Timeout)
+	}
+	if c.Health.CacheTTL < 0 {
+		errs.Addf("health.cachettl", "must not be negative, got %s", c.Health.CacheTTL)
+	}
+	if c.Health.PoolSaturation <= 0 || c.Health.PoolSaturation > 1 {
+		errs.Addf("health.poolsaturation", "must be greater than 0 and at most 1, got %v", c.Health.PoolSaturation)
+	}
+	for _, r := range c.Health.CriticalRegisters {
+		if _, ok := c.CircuitBreaker.Registers[strings.ToLower(r)]; !ok && !strings.EqualFold(r, DefaultHandler) {
+			errs.Addf("health.criticalregisters", "register %s is not configured", r)
+		}
+	}
+
+	errs.Add("connection.rdb", c.Connection.RDB.Validate())
+	errs.Add("auth", c.Auth.Validate())
+	for r, cb := range c.CircuitBreaker.Registers {
+		errs.Add("circuitbreaker.registers."+r, cb.validate())
+		if cb.BaseURL != "" {
+			if u, err := url.Parse(cb.BaseURL); err != nil || u.Scheme == "" || u.Host == "" {
+				errs.Addf("circuitbreaker.registers."+r+".baseurl", "must be an absolute URL, got %q", cb.BaseURL)
+			}
+		}
+	}
+	errs.Add("tracing", c.Tracing.Validate())
+	errs.Add("faultinjection", c.FaultInjection.Validate())
+	return errs.Err()
+}
+
+/*
+WatchConfig applies changes of the configuration file at runtime, see configs.WatchConfig:
+1. A change is rejected unless the whole candidate configuration passes LoadConfig.
+2. Changes of "logging" are applied by logging.Configure, and thresholds of circuit breakers by reloadCircuitBreakers.
+If logging.Configure fails, e.g. a sink can't be opened, the change is rejected and the old configuration is kept.
+3. Other changes take effect after restart, i.e. Config injected into subsystems at startup is never modified.
+*/
+func WatchConfig() {
+	configs.RegisterValidator("", func(candidate configs.Config) error {
+		_, err := LoadConfig(candidate)
+		return err
+	})
+	configs.Subscribe("logging", func(_, new configs.Config) error {
+		cfg, err := LoadConfig(new)
+		if err == nil {
+			err = logging.Configure(cfg.Logging)
+		}
+		if err != nil {
+			return err
+		}
+		log.Warnf("***** [LOGGING] ***** Apply change of logging, levels changed at runtime are reset")
+		return nil
+	})
+	configs.WatchConfig()
+}
@@ -0,0 +1,188 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"golang.org/x/time/rate"
+
+	"github.com/linushung/artemis/internal/pkg/faults"
+	"github.com/linushung/artemis/internal/pkg/httpcache"
+	"github.com/linushung/artemis/internal/pkg/requestid"
+	"github.com/linushung/artemis/internal/pkg/tracing"
+)
+
+// ErrRateLimited returns when the rate limiter of register has no token for the request in time
+var ErrRateLimited = errors.New("rate limited")
+
+// TransportConfig represents the connection pool dedicated to a register
+type TransportConfig struct {
+	MaxConnsPerHost     int           `mapstructure:"maxconnsperhost" json:"maxConnsPerHost"`
+	MaxIdleConns        int           `mapstructure:"maxidleconns" json:"maxIdleConns"`
+	MaxIdleConnsPerHost int           `mapstructure:"maxidleconnsperhost" json:"maxIdleConnsPerHost"`
+	IdleConnTimeout     time.Duration `mapstructure:"idleconntimeout" json:"idleConnTimeout"`
+}
+
+// WithDefaults returns a copy of configuration whose unset fields are replaced with default values
+func (c TransportConfig) WithDefaults() TransportConfig {
+	if c.MaxConnsPerHost <= 0 {
+		c.MaxConnsPerHost = defaultMaxConnsPerHost
+	}
+	if c.MaxIdleConns <= 0 {
+		c.MaxIdleConns = defaultMaxIdleConns
+	}
+	if c.MaxIdleConnsPerHost <= 0 {
+		c.MaxIdleConnsPerHost = defaultMaxIdleConnsPerHost
+	}
+	if c.IdleConnTimeout <= 0 {
+		c.IdleConnTimeout = defaultIdleConnTimeout
+	}
+
+	return c
+}
+
+/* Ref: https://pkg.go.dev/golang.org/x/time/rate */
+// RateLimitConfig represents the token bucket limiting outbound requests of a register
+type RateLimitConfig struct {
+	// Rate is the number of requests allowed per second, 0 disables rate limiting
+	Rate float64 `mapstructure:"rate" json:"rate"`
+	// Burst is the size of token bucket. Default to 1
+	Burst int `mapstructure:"burst" json:"burst"`
+	// MaxWait is how long a request waits for a token before being rejected, 0 rejects immediately
+	MaxWait time.Duration `mapstructure:"maxwait" json:"maxWait"`
+}
+
+// CacheConfig represents the in-memory cache of GET responses of a register, see package httpcache
+type CacheConfig struct {
+	// MaxEntries is the number of URLs cached in LRU order, 0 disables caching. See httpcache.MaxVariants of a URL
+	MaxEntries int `mapstructure:"maxentries" json:"maxEntries"`
+	// ServeStale serves cached responses even if they're stale when circuit breaker is open
+	ServeStale bool `mapstructure:"servestale" json:"serveStale"`
+	// MaxStale is how long after expiry a cached response can be served by ServeStale, 0 means no limit
+	MaxStale time.Duration `mapstructure:"maxstale" json:"maxStale"`
+}
+
+/*
+downstream holds the resources isolated per register, so one slow partner exhausting its connections or tokens
+doesn't starve the others.
+*/
+type downstream struct {
+	http      *HTTPClient
+	retry     *RetryHTTPClient
+	limiter   *rate.Limiter
+	rateLimit RateLimitConfig
+	cache     *httpcache.Cache
+	cacheConf CacheConfig
+}
+
+func newDownstream(c *circuitBreakerConfig) *downstream {
+	rt := outboundTransport(newTransport(c.Transport))
+	d := &downstream{rateLimit: c.RateLimit, cacheConf: c.Cache}
+	if c.Cache.MaxEntries > 0 {
+		d.cache = httpcache.New(c.Cache.MaxEntries)
+		rt = &httpcache.Transport{Cache: d.cache, Base: rt}
+	}
+	d.http = &HTTPClient{&http.Client{Timeout: timeout, Transport: rt}}
+	d.retry = NewRetryClient(c.Retry, rt)
+	if c.RateLimit.Rate > 0 {
+		burst := c.RateLimit.Burst
+		if burst <= 0 {
+			burst = 1
+		}
+		d.limiter = rate.NewLimiter(rate.Limit(c.RateLimit.Rate), burst)
+	}
+
+	return d
+}
+
+// outboundTransport wraps base with tracing, X-Request-ID propagation and fault injection of outbound requests
+func outboundTransport(base http.RoundTripper) http.RoundTripper {
+	return tracedTransport(requestid.WrapTransport(faults.WrapTransport(base)))
+}
+
+/* Ref: https://pkg.go.dev/go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp */
+// tracedTransport starts a client span of each outbound request and propagates its context by "traceparent" header
+func tracedTransport(base http.RoundTripper) http.RoundTripper {
+	return otelhttp.NewTransport(base, otelhttp.WithPropagators(tracing.Propagator()))
+}
+
+/* Ref: http.DefaultTransport */
+// newTransport returns a transport with its own connection pool
+func newTransport(c TransportConfig) *http.Transport {
+	c = c.WithDefaults()
+	return &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxConnsPerHost:       c.MaxConnsPerHost,
+		MaxIdleConns:          c.MaxIdleConns,
+		MaxIdleConnsPerHost:   c.MaxIdleConnsPerHost,
+		IdleConnTimeout:       c.IdleConnTimeout,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: defaultExpectContinueTimeout,
+	}
+}
+
+// wait takes a token of rate limiter, waiting for at most MaxWait
+func (d *downstream) wait(ctx context.Context) error {
+	if d.limiter == nil {
+		return nil
+	}
+	if d.rateLimit.MaxWait <= 0 {
+		if !d.limiter.Allow() {
+			return ErrRateLimited
+		}
+		return nil
+	}
+
+	waitCtx, cancel := context.WithTimeout(ctx, d.rateLimit.MaxWait)
+	defer cancel()
+	if err := d.limiter.Wait(waitCtx); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return ErrRateLimited
+	}
+	return nil
+}
+
+// stale returns the cached response of req to serve while the circuit breaker of downstream is open
+func (d *downstream) stale(req *Request) (*Response, bool) {
+	if !d.cacheConf.ServeStale {
+		return nil, false
+	}
+
+	res, ok := d.cached(req)
+	if ok {
+		res.Stale = true
+	}
+	return res, ok
+}
+
+// cached returns the last known good response of req in cache, fresh or stale for at most MaxStale
+func (d *downstream) cached(req *Request) (*Response, bool) {
+	if d.cache == nil || req.Method != http.MethodGet {
+		return nil, false
+	}
+	r, err := req.newHTTPRequest(context.Background())
+	if err != nil {
+		return nil, false
+	}
+
+	cached, ok := d.cache.Stale(r, d.cacheConf.MaxStale)
+	if !ok {
+		return nil, false
+	}
+	res, err := readResponse(cached)
+	if err != nil {
+		return nil, false
+	}
+	return res, true
+}
@@ -0,0 +1,154 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// Types of fallback of a register
+const (
+	// FallbackStatic serves the response configured in StatusCode, Header and Body
+	FallbackStatic = "static"
+	// FallbackCache serves the last known good response in cache of register, see CacheConfig
+	FallbackCache = "cache"
+	// FallbackURL sends the request to URL instead, only requests without body are sent
+	FallbackURL = "url"
+	// FallbackCustom calls the function registered with RegisterFallback by Name
+	FallbackCustom = "custom"
+)
+
+// FallbackHeader marks a response served by fallback with the type of fallback
+const FallbackHeader = "X-Fallback"
+
+/*
+FallbackServed returns from CBHTTPGet and CBHTTPPost along with the body of a fallback served instead of the failed
+request, so callers can tell it apart from a response of downstream and serve its status code and header as well.
+*/
+type FallbackServed struct {
+	Response *Response
+}
+
+func (e FallbackServed) Error() string {
+	return fmt.Sprintf("***** [HTTP::FALLBACK] *****[Type:%s] [StatusCode:%d]", e.Response.Fallback, e.Response.StatusCode)
+}
+
+// Fallback returns the response served instead when the request of a register fails
+type Fallback func(ctx context.Context, req *Request, err error) (*Response, error)
+
+// FallbackConfig represents the fallback of a register, no fallback is served if Type is empty
+type FallbackConfig struct {
+	Type       string            `mapstructure:"type" json:"type"`
+	StatusCode int               `mapstructure:"statuscode" json:"statusCode,omitempty"`
+	Header     map[string]string `mapstructure:"header" json:"header,omitempty"`
+	Body       string            `mapstructure:"body" json:"body,omitempty"`
+	URL        string            `mapstructure:"url" json:"url,omitempty"`
+	Name       string            `mapstructure:"name" json:"name,omitempty"`
+}
+
+var fallbacks = struct {
+	sync.RWMutex
+	funcs map[string]Fallback
+}{funcs: map[string]Fallback{}}
+
+// RegisterFallback registers a custom fallback which registers refer to by name with type "custom". It has to be
+// called before InitCircuitBreakerMgr, which fails if a custom fallback of any register isn't registered
+func RegisterFallback(name string, f Fallback) {
+	fallbacks.Lock()
+	defer fallbacks.Unlock()
+
+	fallbacks.funcs[strings.ToLower(name)] = f
+}
+
+func customFallback(name string) (Fallback, bool) {
+	fallbacks.RLock()
+	defer fallbacks.RUnlock()
+
+	f, ok := fallbacks.funcs[strings.ToLower(name)]
+	return f, ok
+}
+
+func (c FallbackConfig) validate() error {
+	switch c.Type {
+	case "", FallbackCache:
+	case FallbackStatic:
+		if c.StatusCode != 0 && http.StatusText(c.StatusCode) == "" {
+			return fmt.Errorf("invalid status code of static fallback: %d", c.StatusCode)
+		}
+	case FallbackURL:
+		if c.URL == "" {
+			return fmt.Errorf("url of fallback is required")
+		}
+	case FallbackCustom:
+		if c.Name == "" {
+			return fmt.Errorf("name of custom fallback is required")
+		}
+	default:
+		return fmt.Errorf("unknown type of fallback: %s", c.Type)
+	}
+
+	return nil
+}
+
+/*
+fallback returns the response served instead of failed req by the fallback of register. Nothing is served if the
+register has no fallback or its fallback has nothing to serve, e.g. no response cached.
+*/
+func (cbm CircuitBreakerManager) fallback(ctx context.Context, register string, req *Request, err error) (*Response, bool) {
+	c := cbm.Register[register].Fallback
+	var res *Response
+	var fbErr error
+	switch c.Type {
+	case FallbackStatic:
+		res = c.static()
+	case FallbackCache:
+		if cached, ok := cbm.downstreams[register].cached(req); ok {
+			res = cached
+		}
+	case FallbackURL:
+		if req.Body != nil {
+			return nil, false
+		}
+		alt := *req
+		alt.URL = c.URL
+		res, fbErr = cbm.downstreams[register].http.Send(ctx, &alt)
+	case FallbackCustom:
+		f, ok := customFallback(c.Name)
+		if !ok {
+			logger.WithContext(ctx).Errorf("***** [CIRCUITBREAKER:%s][FALLBACK][FAIL] ***** Custom fallback %s isn't registered", register, c.Name)
+			return nil, false
+		}
+		res, fbErr = f(ctx, req, err)
+	default:
+		return nil, false
+	}
+
+	if fbErr != nil || res == nil {
+		logger.WithContext(ctx).Errorf("***** [CIRCUITBREAKER:%s][FALLBACK][FAIL] ***** Fallback %s serves nothing:: %v", register, c.Type, fbErr)
+		return nil, false
+	}
+	res.Fallback = c.Type
+	cbFallbacks.WithLabelValues(register, c.Type).Inc()
+	logger.WithContext(ctx).Warnf("***** [CIRCUITBREAKER:%s][FALLBACK] ***** Serve %s fallback of [METHOD:%s] [URL:%s] failed with:: %v", register, c.Type, req.Method, req.URL, err)
+	return res, true
+}
+
+func (c FallbackConfig) static() *Response {
+	code := c.StatusCode
+	if code == 0 {
+		code = http.StatusOK
+	}
+
+	header := http.Header{}
+	for key, value := range c.Header {
+		header.Set(key, value)
+	}
+	return &Response{
+		StatusCode: code,
+		Status:     fmt.Sprintf("%d %s", code, http.StatusText(code)),
+		Header:     header,
+		Body:       []byte(c.Body),
+	}
+}
@@ -1,12 +1,91 @@
 package server
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"net/http"
+	"strings"
+	"sync"
 
 	"github.com/gin-gonic/gin"
+
+	"github.com/linushung/artemis/internal/app/authorization"
+	"github.com/linushung/artemis/internal/pkg/circuitbreaker"
+	"github.com/linushung/artemis/internal/pkg/health"
 )
 
+// defaultPoolSaturation is the ratio of connections in use to MaxOpenConns at which the pool is saturated
+const defaultPoolSaturation = 1.0
+
 // HTTPPing generates PONG response to a Ping request for health checking
 func (s *BaseServer) HTTPPing(c *gin.Context) {
 	c.String(http.StatusOK, "PONG")
 }
+
+/*
+NewReadiness creates readiness of Artemis with checkers of its dependencies by HealthConfig:
+1. database: ping primary of PostgreSQL.
+2. dbpool: connections in use reach poolsaturation of MaxOpenConns and requests started waiting for a connection.
+3. circuitbreakers: none of circuit breakers of criticalregisters is open.
+4. jwt: the key pair of JWT is loaded.
+*/
+func (s *BaseServer) NewReadiness() *health.Health {
+	c := s.Config.Health
+	h := health.New(c.Timeout, c.CacheTTL)
+
+	h.Register("database", health.CheckerFunc(s.RDB.Ping))
+	h.Register("dbpool", s.poolChecker(c.PoolSaturation))
+	h.Register("circuitbreakers", s.breakerChecker(c.CriticalRegisters))
+	h.Register("jwt", health.CheckerFunc(func(ctx context.Context) error {
+		if !authorization.KeyLoaded() {
+			return errors.New("key pair of JWT is not loaded")
+		}
+		return nil
+	}))
+	return h
+}
+
+// poolChecker fails only if the pool is saturated and more requests waited since the last check, so a busy pool
+// which still serves requests in time doesn't flap readiness
+func (s *BaseServer) poolChecker(saturation float64) health.Checker {
+	var mu sync.Mutex
+	var lastWaitCount int64
+	return health.CheckerFunc(func(ctx context.Context) error {
+		stats := s.RDB.Stats()
+
+		mu.Lock()
+		waited := stats.WaitCount > lastWaitCount
+		lastWaitCount = stats.WaitCount
+		mu.Unlock()
+
+		if stats.MaxOpenConnections <= 0 || !waited {
+			return nil
+		}
+		if float64(stats.InUse) >= saturation*float64(stats.MaxOpenConnections) {
+			return fmt.Errorf("pool is saturated: %d/%d connections in use, %d requests waited",
+				stats.InUse, stats.MaxOpenConnections, stats.WaitCount)
+		}
+		return nil
+	})
+}
+
+// breakerChecker fails if any circuit breaker of registers is open, an unknown register is reported as well
+func (s *BaseServer) breakerChecker(registers []string) health.Checker {
+	return health.CheckerFunc(func(ctx context.Context) error {
+		var down []string
+		for _, r := range registers {
+			cb, err := s.CircuitBreaker(r)
+			if err != nil {
+				down = append(down, fmt.Sprintf("%s (%v)", r, err))
+			} else if cb.State == circuitbreaker.Open.String() {
+				down = append(down, r+" (open)")
+			}
+		}
+
+		if len(down) > 0 {
+			return fmt.Errorf("circuit breakers of critical registers are not available: %s", strings.Join(down, ", "))
+		}
+		return nil
+	})
+}
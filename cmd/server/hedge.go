@@ -0,0 +1,107 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/linushung/artemis/internal/pkg/circuitbreaker"
+)
+
+const defaultHedgeMaxAttempts = 2
+
+/* Ref: https://research.google/pubs/pub40801/ (The Tail at Scale) */
+// HedgeConfig represents the request hedging of idempotent reads of a register
+type HedgeConfig struct {
+	// Delay is how long to wait for a response before sending another attempt in parallel, 0 disables hedging
+	Delay time.Duration `mapstructure:"delay" json:"delay"`
+	// MaxAttempts is the number of attempts in parallel including the initial request. Default to 2
+	MaxAttempts int `mapstructure:"maxattempts" json:"maxAttempts"`
+}
+
+// WithDefaults returns a copy of configuration whose unset fields are replaced with default values
+func (c HedgeConfig) WithDefaults() HedgeConfig {
+	if c.MaxAttempts <= 0 {
+		c.MaxAttempts = defaultHedgeMaxAttempts
+	}
+
+	return c
+}
+
+// hedgeable reports whether req is an idempotent read which is safe to be sent more than once in parallel
+func (c HedgeConfig) hedgeable(req *Request) bool {
+	if c.Delay <= 0 || c.MaxAttempts < 2 || req.Body != nil {
+		return false
+	}
+
+	return req.Method == http.MethodGet || req.Method == http.MethodHead
+}
+
+type hedgeResult struct {
+	res *Response
+	err error
+}
+
+// failed reports whether the attempt can't win, including a 5xx or fallback response returned without error
+func (r hedgeResult) failed() bool {
+	return r.err != nil || r.res == nil || r.res.Fallback != "" || r.res.StatusCode >= http.StatusInternalServerError
+}
+
+// rejected reports whether the attempt is rejected without reaching downstream, so another attempt would be as well
+func (r hedgeResult) rejected() bool {
+	return errors.Is(r.err, circuitbreaker.ErrOpen) || errors.Is(r.err, circuitbreaker.ErrMaxConcurrency) ||
+		errors.Is(r.err, ErrRateLimited)
+}
+
+/*
+hedge sends another attempt of req whenever no response arrives within Delay, or at once when an attempt fails, until
+MaxAttempts attempts are made. Each attempt goes through the circuit breaker of register. The first success wins and
+cancels the others, otherwise the result of the last attempt is returned.
+*/
+func (cbm CircuitBreakerManager) hedge(ctx context.Context, register string, req *Request, client sender, c HedgeConfig) (*Response, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan hedgeResult, c.MaxAttempts)
+	launch := func() {
+		go func() {
+			res, err := cbm.do(ctx, register, req, client)
+			results <- hedgeResult{res, err}
+		}()
+	}
+
+	launch()
+	launched, inFlight := 1, 1
+	timer := time.NewTimer(c.Delay)
+	defer timer.Stop()
+
+	hedge := func() {
+		cbHedges.WithLabelValues(register).Inc()
+		launch()
+		launched++
+		inFlight++
+	}
+
+	var last hedgeResult
+	for inFlight > 0 {
+		select {
+		case <-timer.C:
+			if launched < c.MaxAttempts {
+				hedge()
+				timer.Reset(c.Delay)
+			}
+		case r := <-results:
+			inFlight--
+			if !r.failed() {
+				return r.res, nil
+			}
+			last = r
+			if launched < c.MaxAttempts && !r.rejected() && ctx.Err() == nil {
+				hedge()
+			}
+		}
+	}
+
+	return last.res, last.err
+}
@@ -0,0 +1,78 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestHedgeAfterFastFailure(t *testing.T) {
+	const register = "hedged"
+	// Attempts fail at once until failures run out, then succeed
+	var attempts, failures int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		if atomic.AddInt32(&failures, -1) >= 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	cbm, err := newCircuitBreakerManager(CircuitBreakersConfig{Registers: map[string]*circuitBreakerConfig{
+		register: {BaseURL: srv.URL, Hedge: HedgeConfig{Delay: time.Second, MaxAttempts: 2}},
+	}})
+	if err != nil {
+		t.Fatalf("newCircuitBreakerManager:: %v", err)
+	}
+	hedges := func() float64 { return testutil.ToFloat64(cbHedges.WithLabelValues(register)) }
+
+	atomic.StoreInt32(&failures, 1)
+	before, start := hedges(), time.Now()
+	if res, err := do(cbm, register, http.MethodGet, "/get"); err != nil || res.StatusCode != http.StatusOK {
+		t.Fatalf("hedged request after 503 = %v, want 200", err)
+	}
+	if elapsed := time.Since(start); elapsed >= time.Second {
+		t.Errorf("hedge after 503 is sent after %s, want before delay", elapsed)
+	}
+	if n := hedges() - before; n != 1 {
+		t.Errorf("hedges = %v, want 1", n)
+	}
+
+	// Attempts stop at MaxAttempts and the last failure is returned
+	atomic.StoreInt32(&failures, 10)
+	atomic.StoreInt32(&attempts, 0)
+	_, err = do(cbm, register, http.MethodGet, "/get")
+	var httpErr HTTPError
+	if !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("hedged request of failing downstream = %v, want HTTPError of 503", err)
+	}
+	if n := atomic.LoadInt32(&attempts); n != 2 {
+		t.Errorf("attempts of failing downstream = %d, want 2", n)
+	}
+}
+
+func TestHedgeResultFailed(t *testing.T) {
+	tests := []struct {
+		name   string
+		r      hedgeResult
+		failed bool
+	}{
+		{"ok", hedgeResult{res: &Response{StatusCode: http.StatusOK}}, false},
+		{"not found", hedgeResult{res: &Response{StatusCode: http.StatusNotFound}}, false},
+		{"server error", hedgeResult{res: &Response{StatusCode: http.StatusBadGateway}}, true},
+		{"fallback", hedgeResult{res: &Response{StatusCode: http.StatusOK, Fallback: FallbackStatic}}, true},
+		{"error", hedgeResult{err: ErrRateLimited}, true},
+	}
+	for _, tt := range tests {
+		if failed := tt.r.failed(); failed != tt.failed {
+			t.Errorf("%s: failed = %v, want %v", tt.name, failed, tt.failed)
+		}
+	}
+}
@@ -2,19 +2,25 @@ package server
 
 import (
 	"bytes"
+	"context"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
+	"net/url"
 	"strings"
 	"time"
-
-	log "github.com/sirupsen/logrus"
 )
 
 const (
 	timeout = 4 * time.Second
+	// maxResponseBytes caps bodies of responses read into memory by readResponse
+	maxResponseBytes = 10 << 20
 )
 
+// ErrResponseTooLarge returns when body of a response exceeds maxResponseBytes
+var ErrResponseTooLarge = fmt.Errorf("body of response exceeds %d bytes", maxResponseBytes)
+
 // HTTPError represents a wrapper of http response error
 type HTTPError struct {
 	Status     string
@@ -25,6 +31,33 @@ type HTTPClient struct {
 	*http.Client
 }
 
+// Request represents a generic outbound HTTP request
+type Request struct {
+	Method string
+	URL    string
+	Header http.Header
+	// Query is merged into the query string of URL
+	Query url.Values
+	// Body is streamed to downstream as is. NOTE: RetryHTTPClient buffers it in order to rewind between retries
+	Body io.Reader
+}
+
+/*
+Response represents a generic outbound HTTP response. NOTE: only bodies of requests are streamed, Body of response is
+read into memory as a whole (at most maxResponseBytes), since circuit breakers, retries, hedging, caching and body
+logging need the complete response before it's returned to callers.
+*/
+type Response struct {
+	StatusCode int
+	Status     string
+	Header     http.Header
+	Body       []byte
+	// Stale reports whether the response is served from cache because downstream is unavailable
+	Stale bool
+	// Fallback is the type of fallback served instead of the failed request, empty if it's not a fallback
+	Fallback string
+}
+
 func InitHTTPClient() *HTTPClient {
 	return &HTTPClient{
 		/* Ref:
@@ -35,6 +68,8 @@ func InitHTTPClient() *HTTPClient {
 		&http.Client{
 			// Instead of using default timeout "0", set timeout to prevent from malicious service trying to blocking requests (and goroutines) indefinitely,
 			Timeout: timeout,
+			// Outbound faults are only injected if fault injection is enabled, see package faults
+			Transport: outboundTransport(nil),
 		},
 	}
 }
@@ -43,6 +78,108 @@ func (e HTTPError) Error() string {
 	return fmt.Sprintf("***** [HTTP::ERROR] *****[Status:%s] [StatusCode:%d]", e.Status, e.StatusCode)
 }
 
+// NewRequest returns a Request with headers converted from a map of single value
+func NewRequest(method, url string, headers map[string]string, body io.Reader) *Request {
+	h := http.Header{}
+	for key, value := range headers {
+		h.Set(key, value)
+	}
+
+	return &Request{Method: strings.ToUpper(method), URL: url, Header: h, Body: body}
+}
+
+// url returns URL of request with query parameters merged
+func (r *Request) url() (string, error) {
+	if len(r.Query) == 0 {
+		return r.URL, nil
+	}
+
+	u, err := url.Parse(r.URL)
+	if err != nil {
+		return "", err
+	}
+	q := u.Query()
+	for key, values := range r.Query {
+		for _, v := range values {
+			q.Add(key, v)
+		}
+	}
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// newHTTPRequest creates a *http.Request bound to ctx from Request
+func (r *Request) newHTTPRequest(ctx context.Context) (*http.Request, error) {
+	u, err := r.url()
+	if err != nil {
+		return nil, err
+	}
+
+	request, err := http.NewRequestWithContext(ctx, r.Method, u, r.Body)
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range r.Header {
+		request.Header[key] = values
+	}
+	return request, nil
+}
+
+// IsSuccess reports whether the status code of response is 2xx
+func (r *Response) IsSuccess() bool {
+	return r.StatusCode >= 200 && r.StatusCode < 300
+}
+
+// readResponse reads the whole body of *http.Response into Response and closes it, ErrResponseTooLarge returns if the
+// body exceeds maxResponseBytes
+func readResponse(response *http.Response) (*Response, error) {
+	// without closing the response body, the connection may remain open and cause resource leak.
+	defer response.Body.Close()
+
+	if response.ContentLength > maxResponseBytes {
+		return nil, ErrResponseTooLarge
+	}
+	resBody, ioErr := ioutil.ReadAll(io.LimitReader(response.Body, maxResponseBytes+1))
+	if ioErr != nil {
+		return nil, ioErr
+	}
+	if len(resBody) > maxResponseBytes {
+		return nil, ErrResponseTooLarge
+	}
+
+	return &Response{
+		StatusCode: response.StatusCode,
+		Status:     response.Status,
+		Header:     response.Header,
+		Body:       resBody,
+	}, nil
+}
+
+// Send makes HTTP request of any method and returns the response of any status code. Error is only returned when
+// the request cannot be made, e.g. connection failure, timeout or cancellation of ctx
+func (hc HTTPClient) Send(ctx context.Context, r *Request) (*Response, error) {
+	request, err := r.newHTTPRequest(ctx)
+	if err != nil {
+		logger.WithContext(ctx).Errorf("***** HTTPSend::[FAIL] *****[METHOD:%s] [URL:%s] Cannot create request [Error:%v] ", r.Method, r.URL, err)
+		return nil, err
+	}
+
+	response, httpErr := hc.Do(request)
+	if httpErr != nil {
+		logger.WithContext(ctx).Errorf("***** HTTPSend::[FAIL] *****[METHOD:%s] [URL:%s] [HEADERS:%s] [Error:%v] ", r.Method, r.URL, r.Header, httpErr)
+		return nil, httpErr
+	}
+
+	res, ioErr := readResponse(response)
+	if ioErr != nil {
+		logger.WithContext(ctx).Errorf("***** HTTPSend::[FAIL] *****ReadAll Execution [Error:%v] ", ioErr)
+		return nil, ioErr
+	}
+
+	return res, nil
+}
+
+// HTTPRequest makes HTTP request of any method and returns the body of 200 response
 func (hc HTTPClient) HTTPRequest(method, url string, headers map[string]string, reqBody []byte) ([]byte, error) {
 	switch strings.ToUpper(method) {
 	case "GET":
@@ -52,14 +189,21 @@ func (hc HTTPClient) HTTPRequest(method, url string, headers map[string]string,
 	case "DELETE":
 		return hc.HTTPDelete(url, headers)
 	default:
-		return nil, fmt.Errorf("net/http: invalid method %q", method)
+		res, err := hc.Send(context.Background(), NewRequest(method, url, headers, bytes.NewReader(reqBody)))
+		if err != nil {
+			return nil, err
+		}
+		if res.StatusCode != 200 {
+			return nil, HTTPError{res.Status, res.StatusCode}
+		}
+		return res.Body, nil
 	}
 }
 
 // HTTPGet implement HTTP GET request
 func (hc HTTPClient) HTTPGet(url string, headers map[string]string) ([]byte, error) {
 	request, _ := http.NewRequest("GET", url, nil)
-	log.Printf("***** HTTPGet *****[URL:%s] [HEADERS:%s]", url, headers)
+	logger.Printf("***** HTTPGet *****[URL:%s] [HEADERS:%s]", url, headers)
 
 	if len(headers) > 0 {
 		for key, value := range headers {
@@ -69,11 +213,11 @@ func (hc HTTPClient) HTTPGet(url string, headers map[string]string) ([]byte, err
 
 	response, httpErr := hc.Do(request)
 	if httpErr != nil {
-		log.Errorf("***** HTTPGet::[FAIL] *****[URL:%s] [HEADERS:%s] [Error:%v] ", url, headers, httpErr)
+		logger.Errorf("***** HTTPGet::[FAIL] *****[URL:%s] [HEADERS:%s] [Error:%v] ", url, headers, httpErr)
 		return nil, httpErr
 	}
 	if response.StatusCode != 200 {
-		log.Errorf("***** HTTPGet::[FAIL] *****[URL:%s] [HEADERS:%s] [StatusCode:%d] [RESPONSE:%s] ", url, headers, response.StatusCode, response.Status)
+		logger.Errorf("***** HTTPGet::[FAIL] *****[URL:%s] [HEADERS:%s] [StatusCode:%d] [RESPONSE:%s] ", url, headers, response.StatusCode, response.Status)
 		return nil, HTTPError{response.Status, response.StatusCode}
 	}
 	// without closing the response body, the connection may remain open and cause resource leak.
@@ -81,7 +225,7 @@ func (hc HTTPClient) HTTPGet(url string, headers map[string]string) ([]byte, err
 
 	resBody, ioErr := ioutil.ReadAll(response.Body)
 	if ioErr != nil {
-		log.Errorf("***** HTTPGet::[FAIL] *****ReadAll Execution [Error:%v] ", ioErr)
+		logger.Errorf("***** HTTPGet::[FAIL] *****ReadAll Execution [Error:%v] ", ioErr)
 		return nil, ioErr
 	}
 
@@ -91,7 +235,8 @@ func (hc HTTPClient) HTTPGet(url string, headers map[string]string) ([]byte, err
 // HTTPPost implement HTTP POST request
 func (hc HTTPClient) HTTPPost(url string, headers map[string]string, reqBody []byte) ([]byte, error) {
 	request, _ := http.NewRequest("POST", url, bytes.NewReader(reqBody))
-	log.Printf("***** HTTPPost *****[URL:%s] [HEADERS:%s] [BODY:%s] ", url, headers, string(reqBody))
+	// Bodies aren't logged since they may carry PII, see BodyLogConfig for logging bodies of a register
+	logger.Printf("***** HTTPPost *****[URL:%s] [HEADERS:%s] [BODY:%d bytes] ", url, headers, len(reqBody))
 
 	if len(headers) > 0 {
 		for key, value := range headers {
@@ -101,29 +246,29 @@ func (hc HTTPClient) HTTPPost(url string, headers map[string]string, reqBody []b
 
 	response, httpErr := hc.Do(request)
 	if httpErr != nil {
-		log.Errorf("***** HTTPPost::[FAIL] *****[URL:%s] [HEADERS:%s] [BODY:%s] [Error:%v] ", url, headers, string(reqBody), httpErr)
+		logger.Errorf("***** HTTPPost::[FAIL] *****[URL:%s] [HEADERS:%s] [BODY:%d bytes] [Error:%v] ", url, headers, len(reqBody), httpErr)
 		return nil, httpErr
 	}
 	if response.StatusCode != 200 {
-		log.Errorf("***** HTTPPost::[FAIL] *****[URL:%s] [HEADERS:%s] [BODY:%s] [StatusCode:%d] [RESPONSE:%s] ", url, headers, string(reqBody), response.StatusCode, response.Status)
+		logger.Errorf("***** HTTPPost::[FAIL] *****[URL:%s] [HEADERS:%s] [BODY:%d bytes] [StatusCode:%d] [RESPONSE:%s] ", url, headers, len(reqBody), response.StatusCode, response.Status)
 		return nil, HTTPError{response.Status, response.StatusCode}
 	}
 	defer response.Body.Close()
 
 	resBody, ioErr := ioutil.ReadAll(response.Body)
 	if ioErr != nil {
-		log.Errorf("***** HTTPPost::[FAIL] *****ReadAll Execution [Error:%v] ", ioErr)
+		logger.Errorf("***** HTTPPost::[FAIL] *****ReadAll Execution [Error:%v] ", ioErr)
 		return nil, ioErr
 	}
 
-	log.Infof("***** HTTPPost::[SUCCESS] *****[URL:%s] [RESPONSE:%s] ", url, resBody)
+	logger.Infof("***** HTTPPost::[SUCCESS] *****[URL:%s] [RESPONSE:%d bytes] ", url, len(resBody))
 	return resBody, nil
 }
 
 // HTTPDelete implement HTTP DELETE request
 func (hc HTTPClient) HTTPDelete(url string, headers map[string]string) ([]byte, error) {
 	request, _ := http.NewRequest("DELETE", url, bytes.NewReader([]byte{}))
-	log.Printf("***** HTTPDelete *****[URL:%s] [HEADERS:%s] ", url, headers)
+	logger.Printf("***** HTTPDelete *****[URL:%s] [HEADERS:%s] ", url, headers)
 
 	if len(headers) > 0 {
 		for key, value := range headers {
@@ -133,21 +278,21 @@ func (hc HTTPClient) HTTPDelete(url string, headers map[string]string) ([]byte,
 
 	response, httpErr := hc.Do(request)
 	if httpErr != nil {
-		log.Errorf("***** HTTPDelete::[FAIL] *****[URL:%s] [HEADERS:%s] [Error:%v] ", url, headers, httpErr)
+		logger.Errorf("***** HTTPDelete::[FAIL] *****[URL:%s] [HEADERS:%s] [Error:%v] ", url, headers, httpErr)
 		return nil, httpErr
 	}
 	if response.StatusCode != 200 {
-		log.Errorf("***** HTTPDelete::[FAIL] *****[URL:%s] [HEADERS:%s] [StatusCode:%d] [RESPONSE:%s] ", url, headers, response.StatusCode, response.Status)
+		logger.Errorf("***** HTTPDelete::[FAIL] *****[URL:%s] [HEADERS:%s] [StatusCode:%d] [RESPONSE:%s] ", url, headers, response.StatusCode, response.Status)
 		return nil, HTTPError{response.Status, response.StatusCode}
 	}
 	defer response.Body.Close()
 
 	resBody, ioErr := ioutil.ReadAll(response.Body)
 	if ioErr != nil {
-		log.Errorf("***** HTTPDelete::[FAIL] *****ReadAll Execution [Error:%v] ", ioErr)
+		logger.Errorf("***** HTTPDelete::[FAIL] *****ReadAll Execution [Error:%v] ", ioErr)
 		return nil, ioErr
 	}
 
-	log.Infof("***** HTTPDelete::[SUCCESS] *****[URL:%s] [RESPONSE:%s] ", url, resBody)
+	logger.Infof("***** HTTPDelete::[SUCCESS] *****[URL:%s] [RESPONSE:%d bytes] ", url, len(resBody))
 	return resBody, nil
 }
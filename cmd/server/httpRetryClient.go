@@ -2,18 +2,24 @@ package server
 
 import (
 	"crypto/x509"
+	"fmt"
+	"math"
+	"math/rand"
 	"net/http"
 	"net/url"
 	"regexp"
+	"strconv"
+	"strings"
 	"time"
 
 	rhttp "github.com/hashicorp/go-retryablehttp"
-	log "github.com/sirupsen/logrus"
 	"golang.org/x/net/context"
 )
 
 const (
 	defaultRetryMax              = 2
+	defaultRetryBaseDelay        = 1 * time.Second
+	defaultRetryMaxDelay         = 30 * time.Second
 	defaultMaxConnsPerHost       = 100
 	defaultMaxIdleConns          = 75
 	defaultMaxIdleConnsPerHost   = 75
@@ -26,28 +32,206 @@ type RetryHTTPClient struct {
 	*rhttp.Client
 }
 
+// Backoff types of RetryPolicy
+const (
+	BackoffConstant    = "constant"
+	BackoffExponential = "exponential"
+	BackoffJittered    = "jittered"
+)
+
+// RetryPolicy represents the retry and backoff policy of a register
+type RetryPolicy struct {
+	// MaxAttempts is the number of attempts including the initial request, 0 is replaced by the default
+	MaxAttempts int `mapstructure:"maxattempts" json:"maxAttempts"`
+	// Backoff is one of "constant", "exponential" (default) and "jittered"
+	Backoff   string        `mapstructure:"backoff" json:"backoff"`
+	BaseDelay time.Duration `mapstructure:"basedelay" json:"baseDelay"`
+	MaxDelay  time.Duration `mapstructure:"maxdelay" json:"maxDelay"`
+	// RetryableStatuses replaces the default policy retrying on 5xx (except 501) when it's not empty
+	RetryableStatuses []int `mapstructure:"retryablestatuses" json:"retryableStatuses"`
+	// HonorRetryAfter waits for the delay of Retry-After header (bounded by MaxDelay) if the response has one
+	HonorRetryAfter bool `mapstructure:"honorretryafter" json:"honorRetryAfter"`
+	// NonIdempotent allows retrying non-idempotent methods, e.g. POST and PATCH
+	NonIdempotent bool `mapstructure:"nonidempotent" json:"nonIdempotent"`
+}
+
+// WithDefaults returns a copy of policy whose unset fields are replaced with default values
+func (p RetryPolicy) WithDefaults() RetryPolicy {
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = defaultRetryMax + 1
+	}
+	if p.Backoff == "" {
+		p.Backoff = BackoffExponential
+	}
+	if p.BaseDelay <= 0 {
+		p.BaseDelay = defaultRetryBaseDelay
+	}
+	if p.MaxDelay <= 0 {
+		p.MaxDelay = defaultRetryMaxDelay
+	}
+
+	return p
+}
+
+// validate checks policy before defaults are filled in, zero values of fields are left for WithDefaults
+func (p RetryPolicy) validate() error {
+	if p.MaxAttempts < 0 {
+		return fmt.Errorf("maxattempts of retry must be at least 1: %d", p.MaxAttempts)
+	}
+	switch p.Backoff {
+	case "", BackoffConstant, BackoffExponential, BackoffJittered:
+	default:
+		return fmt.Errorf("unknown backoff of retry: %s", p.Backoff)
+	}
+	if p.BaseDelay < 0 || p.MaxDelay < 0 {
+		return fmt.Errorf("basedelay and maxdelay of retry must not be negative: %s, %s", p.BaseDelay, p.MaxDelay)
+	}
+	if d := p.WithDefaults(); d.MaxDelay < d.BaseDelay {
+		return fmt.Errorf("maxdelay of retry must not be less than basedelay: %s < %s", d.MaxDelay, d.BaseDelay)
+	}
+
+	return nil
+}
+
+/* Ref: https://tools.ietf.org/html/rfc7231#section-4.2.2 */
+// Allows reports whether requests of method can be retried by the policy
+func (p RetryPolicy) Allows(method string) bool {
+	switch strings.ToUpper(method) {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	default:
+		return p.NonIdempotent
+	}
+}
+
+func (p RetryPolicy) checkRetry(ctx context.Context, resp *http.Response, err error) (bool, error) {
+	if err != nil || len(p.RetryableStatuses) == 0 {
+		return defaultRetryPolicy(ctx, resp, err)
+	}
+	if ctx.Err() != nil {
+		return false, ctx.Err()
+	}
+
+	for _, status := range p.RetryableStatuses {
+		if resp.StatusCode == status {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+/* Ref: https://aws.amazon.com/blogs/architecture/exponential-backoff-and-jitter/ */
+func (p RetryPolicy) backoff(min, max time.Duration, attemptNum int, resp *http.Response) time.Duration {
+	if p.HonorRetryAfter {
+		if wait, ok := retryAfter(resp); ok {
+			if wait > max {
+				return max
+			}
+			return wait
+		}
+	}
+
+	switch p.Backoff {
+	case BackoffConstant:
+		return min
+	case BackoffJittered:
+		return time.Duration(rand.Int63n(int64(exponentialBackoff(min, max, attemptNum)) + 1))
+	default:
+		// Unknown backoff is rejected by validate, so this is BackoffExponential
+		return exponentialBackoff(min, max, attemptNum)
+	}
+}
+
+func exponentialBackoff(min, max time.Duration, attemptNum int) time.Duration {
+	mult := math.Pow(2, float64(attemptNum)) * float64(min)
+	if mult > float64(max) {
+		return max
+	}
+	return time.Duration(mult)
+}
+
+/* Ref: https://tools.ietf.org/html/rfc7231#section-7.1.3 */
+// retryAfter parses Retry-After header of response in either delay-seconds or HTTP-date
+func retryAfter(resp *http.Response) (time.Duration, bool) {
+	if resp == nil {
+		return 0, false
+	}
+	header := resp.Header.Get("Retry-After")
+	if header == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(header); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(header); err == nil {
+		if wait := time.Until(date); wait > 0 {
+			return wait, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
 /* Ref: https://blog.cloudflare.com/the-complete-guide-to-golang-net-http-timeouts/ */
 // InitRetryClient return a retryable HTTP client with default config of Hermes service
 func InitRetryClient() *RetryHTTPClient {
+	return NewRetryClient(RetryPolicy{}, outboundTransport(newTransport(TransportConfig{})))
+}
+
+// NewRetryClient return a retryable HTTP client applying retry policy over transport
+func NewRetryClient(policy RetryPolicy, t http.RoundTripper) *RetryHTTPClient {
+	policy = policy.WithDefaults()
+
 	rc := rhttp.NewClient()
 	// Replace default timeout "0" for http.client
 	rc.HTTPClient.Timeout = timeout
-	rc.Logger = log.New()
-	rc.RetryMax = defaultRetryMax
-	rc.CheckRetry = defaultRetryPolicy
-	//rc.Backoff = rhttp.LinearJitterBackoff
-
-	// Replace default config for http.Transport
-	t := rc.HTTPClient.Transport.(*http.Transport)
-	t.MaxConnsPerHost = defaultMaxConnsPerHost
-	t.MaxIdleConns = defaultMaxIdleConns
-	t.MaxIdleConnsPerHost = defaultMaxIdleConnsPerHost
-	t.IdleConnTimeout = defaultIdleConnTimeout
-	//t.ExpectContinueTimeout = defaultExpectContinueTimeout
+	rc.HTTPClient.Transport = t
+	// Attempts are logged by the logger of circuitbreaker, so its level applies to them as well
+	rc.Logger = logger
+	rc.RetryMax = policy.MaxAttempts - 1
+	rc.RetryWaitMin = policy.BaseDelay
+	rc.RetryWaitMax = policy.MaxDelay
+	rc.CheckRetry = policy.checkRetry
+	rc.Backoff = policy.backoff
+	rc.RequestLogHook = retryMetricsHook
+	// Return the last response instead of an error when retries are exhausted, so callers can inspect the status code
+	rc.ErrorHandler = rhttp.PassthroughErrorHandler
 
 	return &RetryHTTPClient{rc}
 }
 
+// Send makes retryable HTTP request of any method and returns the last response of any status code
+func (rc RetryHTTPClient) Send(ctx context.Context, r *Request) (*Response, error) {
+	u, err := r.url()
+	if err != nil {
+		return nil, err
+	}
+
+	request, err := rhttp.NewRequest(r.Method, u, r.Body)
+	if err != nil {
+		logger.WithContext(ctx).Errorf("***** RetryHTTPSend::[FAIL] *****[METHOD:%s] [URL:%s] Cannot create request [Error:%v] ", r.Method, r.URL, err)
+		return nil, err
+	}
+	for key, values := range r.Header {
+		request.Header[key] = values
+	}
+
+	response, httpErr := rc.Do(request.WithContext(ctx))
+	if httpErr != nil {
+		logger.WithContext(ctx).Errorf("***** RetryHTTPSend::[FAIL] *****[METHOD:%s] [URL:%s] [HEADERS:%s] [Error:%v] ", r.Method, r.URL, r.Header, httpErr)
+		return nil, httpErr
+	}
+
+	res, ioErr := readResponse(response)
+	if ioErr != nil {
+		logger.WithContext(ctx).Errorf("***** RetryHTTPSend::[FAIL] *****ReadAll Execution [Error:%v] ", ioErr)
+		return nil, ioErr
+	}
+
+	return res, nil
+}
+
 /* Ref: retryablehttp.DefaultRetryPolicy() */
 func defaultRetryPolicy(ctx context.Context, resp *http.Response, err error) (bool, error) {
 	// A regular expression to match the error returned by net/http when the
@@ -0,0 +1,102 @@
+package server
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicyValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy RetryPolicy
+		valid  bool
+	}{
+		{"defaults", RetryPolicy{}, true},
+		{"constant", RetryPolicy{MaxAttempts: 1, Backoff: BackoffConstant}, true},
+		{"exponential", RetryPolicy{Backoff: BackoffExponential, BaseDelay: time.Second, MaxDelay: time.Second}, true},
+		{"jittered", RetryPolicy{Backoff: BackoffJittered}, true},
+		{"unknown backoff", RetryPolicy{Backoff: "linear"}, false},
+		{"negative maxattempts", RetryPolicy{MaxAttempts: -1}, false},
+		{"negative basedelay", RetryPolicy{BaseDelay: -time.Second}, false},
+		{"maxdelay less than basedelay", RetryPolicy{BaseDelay: 2 * time.Second, MaxDelay: time.Second}, false},
+		{"basedelay over default maxdelay", RetryPolicy{BaseDelay: time.Minute}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.policy.validate(); (err == nil) != tt.valid {
+				t.Errorf("validate() = %v, want valid %v", err, tt.valid)
+			}
+		})
+	}
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	min, max := 100*time.Millisecond, time.Second
+	tests := []struct {
+		backoff string
+		attempt int
+		want    time.Duration
+	}{
+		{BackoffConstant, 0, min},
+		{BackoffConstant, 5, min},
+		{BackoffExponential, 0, min},
+		{BackoffExponential, 1, 200 * time.Millisecond},
+		{BackoffExponential, 3, 800 * time.Millisecond},
+		{BackoffExponential, 4, max},
+		{"", 2, 400 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		p := RetryPolicy{Backoff: tt.backoff}
+		if got := p.backoff(min, max, tt.attempt, nil); got != tt.want {
+			t.Errorf("backoff %q of attempt %d = %s, want %s", tt.backoff, tt.attempt, got, tt.want)
+		}
+	}
+
+	p := RetryPolicy{Backoff: BackoffJittered}
+	for attempt := 0; attempt < 6; attempt++ {
+		ceiling := exponentialBackoff(min, max, attempt)
+		for i := 0; i < 100; i++ {
+			if got := p.backoff(min, max, attempt, nil); got < 0 || got > ceiling {
+				t.Fatalf("jittered backoff of attempt %d = %s, want between 0 and %s", attempt, got, ceiling)
+			}
+		}
+	}
+}
+
+func TestRetryPolicyBackoffRetryAfter(t *testing.T) {
+	min, max := 100*time.Millisecond, 10*time.Second
+	withRetryAfter := func(value string) *http.Response {
+		return &http.Response{Header: http.Header{"Retry-After": []string{value}}}
+	}
+
+	tests := []struct {
+		name  string
+		honor bool
+		resp  *http.Response
+		want  time.Duration
+	}{
+		{"seconds", true, withRetryAfter("3"), 3 * time.Second},
+		{"bounded by maxdelay", true, withRetryAfter("120"), max},
+		{"date in the past", true, withRetryAfter(time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat)), 0},
+		{"invalid", true, withRetryAfter("soon"), min},
+		{"negative", true, withRetryAfter("-1"), min},
+		{"without header", true, &http.Response{Header: http.Header{}}, min},
+		{"without response", true, nil, min},
+		{"not honored", false, withRetryAfter("3"), min},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := RetryPolicy{Backoff: BackoffConstant, HonorRetryAfter: tt.honor}
+			if got := p.backoff(min, max, 0, tt.resp); got != tt.want {
+				t.Errorf("backoff = %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	// HTTP-date is rounded to seconds, so the wait is only checked to be within the maximum
+	future := withRetryAfter(time.Now().Add(5 * time.Second).UTC().Format(http.TimeFormat))
+	if got := (RetryPolicy{HonorRetryAfter: true}).backoff(min, max, 0, future); got <= 3*time.Second || got > 5*time.Second {
+		t.Errorf("backoff of Retry-After date 5s later = %s, want between 3s and 5s", got)
+	}
+}
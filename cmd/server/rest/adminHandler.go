@@ -0,0 +1,153 @@
+package rest
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/linushung/artemis/cmd/server"
+	"github.com/linushung/artemis/internal/app/authorization"
+	"github.com/linushung/artemis/internal/pkg/circuitbreaker"
+	"github.com/linushung/artemis/internal/pkg/faults"
+	"github.com/linushung/artemis/internal/pkg/logging"
+)
+
+// fetchDBStats returns statistics of database connection pools of primary and replicas
+func (s *Server) fetchDBStats(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, gin.H{"stats": s.RDB.Stats(), "replicas": s.RDB.ReplicaStatus()})
+}
+
+func adminStatus(err error) int {
+	switch {
+	case errors.Is(err, server.ErrUnknownRegister):
+		return http.StatusNotFound
+	case errors.Is(err, server.ErrNotControllable):
+		return http.StatusNotImplemented
+	default:
+		return http.StatusBadRequest
+	}
+}
+
+func operatorOf(ctx *gin.Context) string {
+	return ctx.MustGet("token").(authorization.Claims).Username
+}
+
+func (s *Server) listCircuitBreakers(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, gin.H{"circuitbreakers": s.CircuitBreakers()})
+}
+
+func (s *Server) fetchCircuitBreaker(ctx *gin.Context) {
+	cb, err := s.CircuitBreaker(ctx.Param("register"))
+	if err != nil {
+		ctx.JSON(adminStatus(err), gin.H{"message": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"circuitbreaker": cb})
+}
+
+// controlCircuitBreaker applies the operation of path ("open", "close", "release", "reset") to a circuit breaker
+func (s *Server) controlCircuitBreaker(ctx *gin.Context) {
+	register, operator := ctx.Param("register"), operatorOf(ctx)
+
+	var err error
+	switch ctx.Param("operation") {
+	case "open":
+		err = s.ForceCircuitBreaker(register, circuitbreaker.Open, operator)
+	case "close":
+		err = s.ForceCircuitBreaker(register, circuitbreaker.Closed, operator)
+	case "release":
+		err = s.ReleaseCircuitBreaker(register, operator)
+	case "reset":
+		err = s.ResetCircuitBreaker(register, operator)
+	default:
+		ctx.JSON(http.StatusNotFound, gin.H{"message": "unknown operation"})
+		return
+	}
+	if err != nil {
+		ctx.JSON(adminStatus(err), gin.H{"message": err.Error()})
+		return
+	}
+
+	s.fetchCircuitBreaker(ctx)
+}
+
+func (s *Server) configureCircuitBreaker(ctx *gin.Context) {
+	req := server.CircuitBreakerConfigUpdate{}
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+
+	if _, err := s.ConfigureCircuitBreaker(ctx.Param("register"), req, operatorOf(ctx)); err != nil {
+		ctx.JSON(adminStatus(err), gin.H{"message": err.Error()})
+		return
+	}
+
+	s.fetchCircuitBreaker(ctx)
+}
+
+func (s *Server) fetchFaults(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, gin.H{"enabled": faults.Get().Enabled(), "rules": faults.Get().Rules()})
+}
+
+// replaceFaults replaces all rules of fault injection, it's forbidden unless fault injection is enabled by config
+func (s *Server) replaceFaults(ctx *gin.Context) {
+	req := struct {
+		Rules []faults.Rule `json:"rules"`
+	}{}
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+
+	s.setFaults(ctx, req.Rules)
+}
+
+func (s *Server) clearFaults(ctx *gin.Context) {
+	s.setFaults(ctx, nil)
+}
+
+func (s *Server) setFaults(ctx *gin.Context, rules []faults.Rule) {
+	if err := faults.Get().SetRules(rules); err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, faults.ErrDisabled) {
+			status = http.StatusForbidden
+		}
+		ctx.JSON(status, gin.H{"message": err.Error()})
+		return
+	}
+
+	logger.Warnf("***** [FAULTS][ADMIN] ***** %s replaces rules of fault injection with %+v", operatorOf(ctx), rules)
+	s.fetchFaults(ctx)
+}
+
+func (s *Server) fetchLogLevels(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, gin.H{"levels": logging.GetLevels()})
+}
+
+// changeLogLevel changes the global level, or level of subsystem if it's given. Level "reset" of a subsystem makes it
+// follow the global level again
+func (s *Server) changeLogLevel(ctx *gin.Context) {
+	req := struct {
+		Subsystem string `json:"subsystem"`
+		Level     string `json:"level" binding:"required"`
+	}{}
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+
+	if err := logging.SetLevel(req.Subsystem, req.Level); err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, logging.ErrUnknownSubsystem) {
+			status = http.StatusNotFound
+		}
+		ctx.JSON(status, gin.H{"message": err.Error()})
+		return
+	}
+
+	logger.Warnf("***** [LOGGING][ADMIN] ***** %s changes level of [%s] to %s", operatorOf(ctx), req.Subsystem, req.Level)
+	s.fetchLogLevels(ctx)
+}
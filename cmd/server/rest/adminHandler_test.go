@@ -0,0 +1,66 @@
+package rest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/linushung/artemis/internal/app/authorization"
+	"github.com/linushung/artemis/internal/pkg/logging"
+)
+
+func TestChangeLogLevel(t *testing.T) {
+	global := logging.GetLevels().Global
+	defer func() {
+		logging.SetLevel(logging.Postgres, "reset")
+		logging.SetLevel("", global)
+	}()
+	logging.Logger(logging.Postgres)
+	logging.Logger(logging.JWT)
+	logging.SetLevel("", "info")
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(func(ctx *gin.Context) { ctx.Set("token", authorization.Claims{Username: "jake"}) })
+	s := &Server{}
+	router.PUT("/logging/levels", s.changeLogLevel)
+
+	tests := []struct {
+		name   string
+		body   string
+		status int
+		levels map[string]string
+	}{
+		{"subsystem", `{"subsystem": "postgres", "level": "warn"}`, http.StatusOK, map[string]string{logging.Postgres: "warning", logging.JWT: "info", logging.REST: "info"}},
+		{"unknown subsystem", `{"subsystem": "cache", "level": "warn"}`, http.StatusNotFound, nil},
+		{"invalid level", `{"subsystem": "jwt", "level": "verbose"}`, http.StatusBadRequest, nil},
+		{"no level", `{"subsystem": "jwt"}`, http.StatusBadRequest, nil},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/logging/levels", strings.NewReader(tt.body)))
+		if w.Code != tt.status {
+			t.Errorf("%s: PUT /logging/levels = %d %s, want %d", tt.name, w.Code, w.Body, tt.status)
+			continue
+		}
+		if tt.levels == nil {
+			continue
+		}
+
+		res := struct {
+			Levels logging.Levels `json:"levels"`
+		}{}
+		if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+			t.Fatalf("%s: response %s:: %v", tt.name, w.Body, err)
+		}
+		for subsystem, level := range tt.levels {
+			if got := res.Levels.Subsystems[subsystem]; got != level {
+				t.Errorf("%s: level of %s = %s, want %s", tt.name, subsystem, got, level)
+			}
+		}
+	}
+}
@@ -25,17 +25,12 @@ func (s *Server) createArticle(ctx *gin.Context) {
 	}
 
 	id := uuid.New()
-	a, err := s.RDB.CreateArticle(id, art)
+	a, err := s.RDB.CreateArticle(ctx.Request.Context(), id, art)
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
-		return
-	}
-	if err := s.RDB.TagArticle(a.TagId, req.Tags); err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		renderError(ctx, err)
 		return
 	}
 
-	a.Tags = req.Tags
 	ctx.JSON(http.StatusCreated, gin.H{"article": a})
 }
 
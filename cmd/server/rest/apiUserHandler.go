@@ -10,15 +10,6 @@ import (
 	"github.com/linushung/artemis/internal/app/database/postgres"
 )
 
-func statusCode(err error) int {
-	switch err.Error() {
-	case "sql: no rows in result set", "row(s) affected: 0":
-		return http.StatusNotFound
-	default:
-		return http.StatusInternalServerError
-	}
-}
-
 func (s *Server) createUser(ctx *gin.Context) {
 	req := &postgres.RegisterReq{}
 	if err := ctx.ShouldBindJSON(req); err != nil {
@@ -39,8 +30,8 @@ func (s *Server) createUser(ctx *gin.Context) {
 		Role:     string(postgres.User),
 	}
 
-	if err := s.RDB.CreatePoster(*p); err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+	if err := s.RDB.CreatePoster(ctx.Request.Context(), *p); err != nil {
+		renderError(ctx, err)
 		return
 	}
 
@@ -54,9 +45,9 @@ func (s *Server) loginUser(ctx *gin.Context) {
 		return
 	}
 
-	p, err := s.RDB.SelectPosterByEmail(req.Email)
+	p, err := s.RDB.SelectPosterByEmail(ctx.Request.Context(), req.Email)
 	if err != nil {
-		ctx.JSON(statusCode(err), gin.H{"message": err.Error()})
+		renderError(ctx, err)
 		return
 	}
 
@@ -89,9 +80,9 @@ func (s *Server) updateUser(ctx *gin.Context) {
 	}
 
 	c := ctx.MustGet("token").(authorization.Claims)
-	p, err := s.RDB.UpdatePoster(c.Subject, req)
+	p, err := s.RDB.UpdatePoster(ctx.Request.Context(), c.Subject, req)
 	if err != nil {
-		ctx.JSON(statusCode(err), gin.H{"message": err.Error()})
+		renderError(ctx, err)
 		return
 	}
 
@@ -100,9 +91,9 @@ func (s *Server) updateUser(ctx *gin.Context) {
 
 func (s *Server) fetchCurrentUser(ctx *gin.Context) {
 	c := ctx.MustGet("token").(authorization.Claims)
-	p, err := s.RDB.SelectPosterByEmail(c.Subject)
+	p, err := s.RDB.SelectPosterByEmail(ctx.Request.Context(), c.Subject)
 	if err != nil {
-		ctx.JSON(statusCode(err), gin.H{"message": err.Error()})
+		renderError(ctx, err)
 		return
 	}
 
@@ -110,15 +101,15 @@ func (s *Server) fetchCurrentUser(ctx *gin.Context) {
 }
 
 func (s *Server) fetchUserProfile(ctx *gin.Context) {
-	p, err := s.RDB.SelectPosterByUsername(ctx.Param("username"))
+	p, err := s.RDB.SelectPosterByUsername(ctx.Request.Context(), ctx.Param("username"))
 	if err != nil {
-		ctx.JSON(statusCode(err), gin.H{"message": err.Error()})
+		renderError(ctx, err)
 		return
 	}
 
-	followers, err := s.RDB.FetchFollowersByEmail(p.Email)
+	followers, err := s.RDB.FetchFollowersByEmail(ctx.Request.Context(), p.Email)
 	if err != nil {
-		ctx.JSON(statusCode(err), gin.H{"message": err.Error()})
+		renderError(ctx, err)
 		return
 	}
 
@@ -140,15 +131,15 @@ func (s *Server) fetchUserProfile(ctx *gin.Context) {
 }
 
 func (s *Server) followUser(ctx *gin.Context) {
-	p, err := s.RDB.SelectPosterByUsername(ctx.Param("username"))
+	p, err := s.RDB.SelectPosterByUsername(ctx.Request.Context(), ctx.Param("username"))
 	if err != nil {
-		ctx.JSON(statusCode(err), gin.H{"message": err.Error()})
+		renderError(ctx, err)
 		return
 	}
 
 	c := ctx.MustGet("token").(authorization.Claims)
-	if err := s.RDB.FollowPoster(p.Email, c.Username); err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+	if err := s.RDB.FollowPoster(ctx.Request.Context(), p.Email, c.Username); err != nil {
+		renderError(ctx, err)
 		return
 	}
 
@@ -161,15 +152,15 @@ func (s *Server) followUser(ctx *gin.Context) {
 }
 
 func (s *Server) unFollowUser(ctx *gin.Context) {
-	p, err := s.RDB.SelectPosterByUsername(ctx.Param("username"))
+	p, err := s.RDB.SelectPosterByUsername(ctx.Request.Context(), ctx.Param("username"))
 	if err != nil {
-		ctx.JSON(statusCode(err), gin.H{"message": err.Error()})
+		renderError(ctx, err)
 		return
 	}
 
 	c := ctx.MustGet("token").(authorization.Claims)
-	if err := s.RDB.UnFollowPoster(p.Email, c.Username); err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+	if err := s.RDB.UnFollowPoster(ctx.Request.Context(), p.Email, c.Username); err != nil {
+		renderError(ctx, err)
 		return
 	}
 
@@ -1,11 +1,14 @@
 package rest
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
+
+	"github.com/linushung/artemis/cmd/server"
 )
 
 const (
@@ -14,40 +17,54 @@ const (
 
 // PostOK mock successful Post request to httpbin
 func (s *Server) PostOK(c *gin.Context) {
-	url := fmt.Sprintf("http://localhost:8000/post")
+	url := s.URLOf(register, "/post")
 	_, httpErr := s.CBHTTPPost(register, url, "", []byte(""))
-	if httpErr != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"message": httpErr.Error(),
-		})
-	} else {
-		c.String(http.StatusOK, "OK")
-	}
+	respond(c, httpErr, http.StatusInternalServerError)
 }
 
 // PostStatus mock response of specific status code from httpbin
 func (s *Server) PostStatus(c *gin.Context) {
-	code, _ := strconv.Atoi(c.Param("code"))
-	url := fmt.Sprintf("http://localhost:8000/status/%d", code)
-	_, httpErr := s.CBHTTPPost(register, url, "", []byte(""))
-	if httpErr != nil {
-		c.JSON(code, gin.H{
-			"message": httpErr.Error(),
+	code, err := strconv.Atoi(c.Param("code"))
+	if err != nil || code < 100 || code > 599 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": fmt.Sprintf("status code must be between 100 and 599: %s", c.Param("code")),
 		})
-	} else {
-		c.String(http.StatusOK, "OK")
+		return
 	}
+	url := s.URLOf(register, fmt.Sprintf("/status/%d", code))
+	_, httpErr := s.CBHTTPPost(register, url, "", []byte(""))
+	respond(c, httpErr, code)
 }
 
 // PostDelay mock delay response of specific seconds from httpbin
 func (s *Server) PostDelay(c *gin.Context) {
-	url := fmt.Sprintf("http://localhost:8000/delay/%s", c.Param("second"))
+	url := s.URLOf(register, "/delay/"+c.Param("second"))
 	_, httpErr := s.CBHTTPPost(register, url, "", []byte(""))
-	if httpErr != nil {
-		c.JSON(http.StatusRequestTimeout, gin.H{
+	respond(c, httpErr, http.StatusRequestTimeout)
+}
+
+/*
+respond replies "OK" if the request to httpbin succeeds, or the status code, header and body of the fallback served
+instead, marked with X-Fallback, so clients can tell it from a response of httpbin. Otherwise the error is replied
+with status.
+*/
+func respond(c *gin.Context, httpErr error, status int) {
+	var fb server.FallbackServed
+	switch {
+	case httpErr == nil:
+		c.String(http.StatusOK, "OK")
+	case errors.As(httpErr, &fb):
+		for key, values := range fb.Response.Header {
+			for _, value := range values {
+				c.Writer.Header().Add(key, value)
+			}
+		}
+		c.Header(server.FallbackHeader, fb.Response.Fallback)
+		c.Status(fb.Response.StatusCode)
+		c.Writer.Write(fb.Response.Body)
+	default:
+		c.JSON(status, gin.H{
 			"message": httpErr.Error(),
 		})
-	} else {
-		c.String(http.StatusOK, "OK")
 	}
 }
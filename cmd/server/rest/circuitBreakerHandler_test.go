@@ -0,0 +1,53 @@
+package rest
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/linushung/artemis/cmd/server"
+)
+
+func TestRespond(t *testing.T) {
+	fallback := &server.Response{
+		StatusCode: http.StatusServiceUnavailable,
+		Header:     http.Header{"Content-Type": {"application/json"}, "Retry-After": {"30"}},
+		Body:       []byte(`{"message": "httpbin service is temporarily unavailable"}`),
+		Fallback:   server.FallbackStatic,
+	}
+	tests := []struct {
+		name     string
+		err      error
+		status   int
+		fallback string
+		header   http.Header
+		body     string
+	}{
+		{"ok", nil, http.StatusOK, "", nil, "OK"},
+		{"fallback", server.FallbackServed{Response: fallback}, http.StatusServiceUnavailable, server.FallbackStatic, fallback.Header, string(fallback.Body)},
+		{"error", errors.New("downstream failure"), http.StatusBadGateway, "", nil, `{"message":"downstream failure"}`},
+	}
+	gin.SetMode(gin.TestMode)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			respond(c, tt.err, http.StatusBadGateway)
+
+			if w.Code != tt.status || w.Body.String() != tt.body {
+				t.Errorf("respond = %d %s, want %d %s", w.Code, w.Body, tt.status, tt.body)
+			}
+			if fb := w.Header().Get(server.FallbackHeader); fb != tt.fallback {
+				t.Errorf("%s = %q, want %q", server.FallbackHeader, fb, tt.fallback)
+			}
+			for key := range tt.header {
+				if got := w.Header().Get(key); got != tt.header.Get(key) {
+					t.Errorf("%s = %q, want %q", key, got, tt.header.Get(key))
+				}
+			}
+		})
+	}
+}
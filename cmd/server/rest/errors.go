@@ -0,0 +1,50 @@
+package rest
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/linushung/artemis/internal/app/database/postgres"
+)
+
+// errorBody represents the stable error response returned to clients
+type errorBody struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+/*
+toErrorBody maps domain errors of storage layer to HTTP status code. Unknown errors are reported as internal server
+error without exposing the message of database driver to clients.
+*/
+func toErrorBody(err error) (int, errorBody) {
+	switch {
+	case errors.Is(err, postgres.ErrNotFound):
+		return http.StatusNotFound, errorBody{"NOT_FOUND", postgres.ErrNotFound.Error()}
+	case errors.Is(err, postgres.ErrConflict):
+		return http.StatusConflict, errorBody{"CONFLICT", postgres.ErrConflict.Error()}
+	case errors.Is(err, postgres.ErrForbidden):
+		return http.StatusForbidden, errorBody{"FORBIDDEN", postgres.ErrForbidden.Error()}
+	case errors.Is(err, postgres.ErrTimeout):
+		return http.StatusGatewayTimeout, errorBody{"TIMEOUT", postgres.ErrTimeout.Error()}
+	default:
+		return http.StatusInternalServerError, errorBody{"INTERNAL", http.StatusText(http.StatusInternalServerError)}
+	}
+}
+
+// renderError writes error response of storage layer for gin handlers
+func renderError(ctx *gin.Context, err error) {
+	status, body := toErrorBody(err)
+	ctx.AbortWithStatusJSON(status, body)
+}
+
+// writeError writes error response of storage layer for chi handlers
+func writeError(w http.ResponseWriter, err error) {
+	status, body := toErrorBody(err)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
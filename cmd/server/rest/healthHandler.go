@@ -0,0 +1,42 @@
+package rest
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/linushung/artemis/internal/pkg/health"
+)
+
+// readinessStatus returns 200 if every check is up, otherwise 503 so the instance is taken out of rotation
+func readinessStatus(r health.Report) int {
+	if r.Up() {
+		return http.StatusOK
+	}
+	return http.StatusServiceUnavailable
+}
+
+// liveness reports the process is able to serve requests, it never checks dependencies so that an outage of
+// PostgreSQL doesn't get Artemis restarted
+func (s *Server) liveness(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, gin.H{"status": health.StatusUp})
+}
+
+// readiness reports whether dependencies of Artemis are usable with details of each check
+func (s *Server) readiness(ctx *gin.Context) {
+	report := s.Health.Ready(ctx.Request.Context())
+	ctx.JSON(readinessStatus(report), report)
+}
+
+func (s *Server) livenessChi(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": health.StatusUp})
+}
+
+func (s *Server) readinessChi(w http.ResponseWriter, r *http.Request) {
+	report := s.Health.Ready(r.Context())
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(readinessStatus(report))
+	json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,53 @@
+package rest
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/linushung/artemis/internal/pkg/health"
+)
+
+func TestReadiness(t *testing.T) {
+	up := health.CheckerFunc(func(context.Context) error { return nil })
+	down := health.CheckerFunc(func(context.Context) error { return errors.New("connection refused") })
+	tests := []struct {
+		name     string
+		checker  health.Checker
+		shutdown bool
+		status   int
+	}{
+		{"dependency up", up, false, http.StatusOK},
+		{"dependency down", down, false, http.StatusServiceUnavailable},
+		{"shutting down", up, true, http.StatusServiceUnavailable},
+	}
+	gin.SetMode(gin.TestMode)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Server{Health: health.New(time.Second, time.Minute)}
+			s.Health.Register("postgres", tt.checker)
+			if tt.shutdown {
+				s.Health.Shutdown()
+			}
+
+			router := gin.New()
+			router.GET("/readyz", s.readiness)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+			if w.Code != tt.status {
+				t.Errorf("GET /readyz = %d, want %d", w.Code, tt.status)
+			}
+
+			w = httptest.NewRecorder()
+			s.readinessChi(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+			if w.Code != tt.status {
+				t.Errorf("GET /readyz of chi = %d, want %d", w.Code, tt.status)
+			}
+		})
+	}
+}
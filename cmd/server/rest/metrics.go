@@ -0,0 +1,125 @@
+package rest
+
+import (
+	"errors"
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-chi/chi"
+	"github.com/go-chi/chi/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/linushung/artemis/cmd/server"
+)
+
+// unmatchedRoute labels requests which match no route, so paths of scanners don't explode the cardinality
+const unmatchedRoute = "unmatched"
+
+var (
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "artemis",
+		Subsystem: "http",
+		Name:      "requests_total",
+		Help:      "Number of HTTP requests by route template, method and status code.",
+	}, []string{"route", "method", "status"})
+	httpLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "artemis",
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "Latency of HTTP requests by route template, method and status code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method", "status"})
+	httpInFlight = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "artemis",
+		Subsystem: "http",
+		Name:      "requests_in_flight",
+		Help:      "Number of HTTP requests being served.",
+	})
+)
+
+/* Ref: https://pkg.go.dev/github.com/prometheus/client_golang/prometheus/collectors#WithGoCollectorRuntimeMetrics */
+// registerMetrics exports metrics of REST API and replaces the default Go collector with runtime/metrics of Go
+func registerMetrics() {
+	prometheus.Unregister(collectors.NewGoCollector())
+	prometheus.MustRegister(
+		httpRequests, httpLatency, httpInFlight,
+		collectors.NewGoCollector(collectors.WithGoCollectorRuntimeMetrics(
+			collectors.GoRuntimeMetricsRule{Matcher: regexp.MustCompile(`^/(gc|memory|sched)/.*`)},
+		)),
+	)
+}
+
+func observeHTTP(route, method string, status int, start time.Time) {
+	if route == "" {
+		route = unmatchedRoute
+	}
+	code := strconv.Itoa(status)
+	httpRequests.WithLabelValues(route, method, code).Inc()
+	httpLatency.WithLabelValues(route, method, code).Observe(time.Since(start).Seconds())
+}
+
+// metricsHandler counts requests and measures latency by route template of gin, e.g. "/api/profiles/:username"
+func metricsHandler() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		start := time.Now()
+		httpInFlight.Inc()
+		defer httpInFlight.Dec()
+
+		ctx.Next()
+		observeHTTP(ctx.FullPath(), ctx.Request.Method, ctx.Writer.Status(), start)
+	}
+}
+
+// metricsMiddleware is the chi version of metricsHandler
+func metricsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		httpInFlight.Inc()
+		defer httpInFlight.Dec()
+
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r)
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		route := ""
+		if rctx := chi.RouteContext(r.Context()); rctx != nil {
+			route = rctx.RoutePattern()
+		}
+		observeHTTP(route, r.Method, status, start)
+	})
+}
+
+/*
+serveMetrics exposes /metrics on port of metrics if it's set and differs from port of REST API, so metrics can be
+scraped from a port which is not exposed publicly. It returns the separate server started, or nil if there is none.
+*/
+func serveMetrics(rest, metrics server.ListenConfig) *http.Server {
+	if metrics.Port == 0 || metrics.Port == rest.Port {
+		return nil
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	srv := &http.Server{
+		Addr:         metrics.Addr(),
+		Handler:      mux,
+		ReadTimeout:  defaultReadTimeout,
+		WriteTimeout: defaultWriteTimeout,
+		IdleTimeout:  defaultIdleTimeout,
+	}
+	go func() {
+		logger.Infof("***** [SERVER:METRICS] ***** Start a metrics server on port %d ......", metrics.Port)
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Fatalf("***** [SERVER:METRICS][FAIL] ***** Failed to start metrics server: %v", err)
+		}
+	}()
+	return srv
+}
@@ -0,0 +1,63 @@
+package rest
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/linushung/artemis/cmd/server"
+	"github.com/linushung/artemis/internal/pkg/health"
+)
+
+func freePort(t *testing.T) int {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+func TestServeMetrics(t *testing.T) {
+	rest := server.ListenConfig{Port: 8080}
+	if srv := serveMetrics(rest, server.ListenConfig{}); srv != nil {
+		t.Errorf("metrics server without port = %s, want nil", srv.Addr)
+	}
+	if srv := serveMetrics(rest, rest); srv != nil {
+		t.Errorf("metrics server on port of REST API = %s, want nil", srv.Addr)
+	}
+
+	port := freePort(t)
+	metricsSrv := serveMetrics(rest, server.ListenConfig{Port: port})
+	if metricsSrv == nil {
+		t.Fatal("metrics server on separate port = nil")
+	}
+	if metricsSrv.ReadTimeout <= 0 || metricsSrv.WriteTimeout <= 0 {
+		t.Errorf("timeouts of metrics server = %s, %s, want positive", metricsSrv.ReadTimeout, metricsSrv.WriteTimeout)
+	}
+
+	url := "http://" + net.JoinHostPort("127.0.0.1", strconv.Itoa(port)) + "/metrics"
+	var res *http.Response
+	var err error
+	for i := 0; i < 50; i++ {
+		if res, err = http.Get(url); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("GET /metrics:: %v", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("GET /metrics = %d, want 200", res.StatusCode)
+	}
+
+	shutdown(&http.Server{}, metricsSrv, health.New(time.Second, 0), server.ShutdownConfig{Timeout: time.Second})
+	if _, err := http.Get(url); err == nil {
+		t.Error("metrics server still serves after shutdown")
+	}
+}
@@ -0,0 +1,277 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-chi/chi"
+	"github.com/go-chi/chi/middleware"
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/linushung/artemis/internal/app/authorization"
+	"github.com/linushung/artemis/internal/app/database/postgres"
+	"github.com/linushung/artemis/internal/pkg/faults"
+	"github.com/linushung/artemis/internal/pkg/requestid"
+	"github.com/linushung/artemis/internal/pkg/tracing"
+)
+
+// adminPrefix is excluded from fault injection so faults can always be removed by admin API
+const adminPrefix = "/admin"
+
+// dbSessionHandler binds a DB session to each request for read-your-own-writes routing between primary and replicas
+func dbSessionHandler() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ctx.Request = ctx.Request.WithContext(postgres.WithSession(ctx.Request.Context()))
+		ctx.Next()
+	}
+}
+
+// dbSessionMiddleware is the chi version of dbSessionHandler
+func dbSessionMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(postgres.WithSession(r.Context())))
+	})
+}
+
+// faultHandler injects faults of target inbound into requests matching route pattern or path, see package faults
+func faultHandler() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if strings.HasPrefix(ctx.Request.URL.Path, adminPrefix) {
+			ctx.Next()
+			return
+		}
+		r, ok := faults.Get().Match(faults.Inbound, ctx.Request.Method, ctx.FullPath(), ctx.Request.URL.Path)
+		if !ok {
+			ctx.Next()
+			return
+		}
+
+		if err := r.Wait(ctx.Request.Context()); err != nil {
+			ctx.Abort()
+			return
+		}
+		switch {
+		case r.Abort:
+			ctx.Abort()
+			faults.Abort(ctx.Writer)
+		case r.Status != 0:
+			ctx.AbortWithStatusJSON(r.Status, gin.H{"message": "fault injected by rule " + r.Name})
+		default:
+			ctx.Next()
+		}
+	}
+}
+
+/*
+faultMiddleware is the chi version of faultHandler. Route pattern is only known after routing, so it has to be
+registered per route with With instead of Use, otherwise rules are matched against path only.
+*/
+func faultMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if strings.HasPrefix(req.URL.Path, adminPrefix) {
+			next.ServeHTTP(w, req)
+			return
+		}
+		subjects := []string{req.URL.Path}
+		if rctx := chi.RouteContext(req.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			subjects = append(subjects, rctx.RoutePattern())
+		}
+		r, ok := faults.Get().Match(faults.Inbound, req.Method, subjects...)
+		if !ok {
+			next.ServeHTTP(w, req)
+			return
+		}
+
+		if err := r.Wait(req.Context()); err != nil {
+			return
+		}
+		switch {
+		case r.Abort:
+			faults.Abort(w)
+		case r.Status != 0:
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(r.Status)
+			json.NewEncoder(w).Encode(map[string]string{"message": "fault injected by rule " + r.Name})
+		default:
+			next.ServeHTTP(w, req)
+		}
+	})
+}
+
+/* Ref: https://opentelemetry.io/docs/specs/semconv/http/http-spans/ */
+// tracingHandler starts a server span of each request continuing the trace of "traceparent" header
+func tracingHandler() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		route := ctx.FullPath()
+		if route == "" {
+			route = ctx.Request.URL.Path
+		}
+		spanCtx, span := startServerSpan(ctx.Request, route)
+		defer span.End()
+
+		ctx.Request = ctx.Request.WithContext(spanCtx)
+		ctx.Next()
+		endServerSpan(span, ctx.Writer.Status())
+	}
+}
+
+// tracingMiddleware is the chi version of tracingHandler, the span is renamed after route is matched
+func tracingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		spanCtx, span := startServerSpan(r, r.URL.Path)
+		defer span.End()
+
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r.WithContext(spanCtx))
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			span.SetName(r.Method + " " + rctx.RoutePattern())
+			span.SetAttributes(semconv.HTTPRoute(rctx.RoutePattern()))
+		}
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		endServerSpan(span, status)
+	})
+}
+
+func startServerSpan(r *http.Request, route string) (context.Context, trace.Span) {
+	ctx := tracing.Propagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+	return tracing.Tracer().Start(ctx, r.Method+" "+route,
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			semconv.HTTPRequestMethodKey.String(r.Method),
+			semconv.HTTPRoute(route),
+			semconv.URLPath(r.URL.Path),
+		),
+	)
+}
+
+func endServerSpan(span trace.Span, status int) {
+	span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+	// Only 5xx are errors of server, 4xx are errors of clients
+	if status >= http.StatusInternalServerError {
+		span.SetStatus(codes.Error, http.StatusText(status))
+	}
+}
+
+// requestIDOf returns X-Request-ID of request if it's valid, otherwise generates a new one
+func requestIDOf(r *http.Request) string {
+	if id := r.Header.Get(requestid.Header); requestid.Valid(id) {
+		return id
+	}
+	return requestid.New()
+}
+
+// requestIDHandler accepts or generates X-Request-ID of each request, stores it in the request context and echoes it
+func requestIDHandler() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id := requestIDOf(ctx.Request)
+		ctx.Request = ctx.Request.WithContext(requestid.NewContext(ctx.Request.Context(), id))
+		ctx.Header(requestid.Header, id)
+		ctx.Next()
+	}
+}
+
+// requestIDMiddleware is the chi version of requestIDHandler
+func requestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := requestIDOf(r)
+		w.Header().Set(requestid.Header, id)
+		next.ServeHTTP(w, r.WithContext(requestid.NewContext(r.Context(), id)))
+	})
+}
+
+// accessEntry represents the access log of a request
+type accessEntry struct {
+	r        *http.Request
+	route    string
+	status   int
+	bytes    int
+	user     string
+	clientIP string
+	latency  time.Duration
+}
+
+/*
+log emits an access log entry logged with context of the request, so request_id, trace_id and span_id are added by
+hooks of logrus. 5xx are logged as errors and 4xx as warnings.
+*/
+func (e accessEntry) log() {
+	if e.route == "" {
+		e.route = unmatchedRoute
+	}
+	entry := logger.WithContext(e.r.Context()).WithFields(log.Fields{
+		"method":     e.r.Method,
+		"route":      e.route,
+		"path":       e.r.URL.Path,
+		"status":     e.status,
+		"bytes":      e.bytes,
+		"latency_ms": float64(e.latency.Microseconds()) / 1000,
+		"user":       e.user,
+		"client_ip":  e.clientIP,
+		"user_agent": e.r.UserAgent(),
+	})
+
+	msg := "***** [ACCESS] ***** " + e.r.Method + " " + e.r.URL.Path
+	switch {
+	case e.status >= http.StatusInternalServerError:
+		entry.Error(msg)
+	case e.status >= http.StatusBadRequest:
+		entry.Warn(msg)
+	default:
+		entry.Info(msg)
+	}
+}
+
+// accessLogHandler emits a structured access log entry of each request, it replaces the unstructured logger of gin
+func accessLogHandler() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		start := time.Now()
+		ctx.Next()
+
+		// ctx.Request carries the context set by later handlers, e.g. the span of tracingHandler
+		e := accessEntry{
+			r:        ctx.Request,
+			route:    ctx.FullPath(),
+			status:   ctx.Writer.Status(),
+			bytes:    ctx.Writer.Size(),
+			clientIP: ctx.ClientIP(),
+			latency:  time.Since(start),
+		}
+		if e.bytes < 0 {
+			e.bytes = 0
+		}
+		if c, ok := ctx.Get("token"); ok {
+			e.user = c.(authorization.Claims).Username
+		}
+		e.log()
+	}
+}
+
+// accessLogMiddleware is the chi version of accessLogHandler
+func accessLogMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r)
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		e := accessEntry{r: r, status: status, bytes: ww.BytesWritten(), clientIP: r.RemoteAddr, latency: time.Since(start)}
+		if rctx := chi.RouteContext(r.Context()); rctx != nil {
+			e.route = rctx.RoutePattern()
+		}
+		e.log()
+	})
+}
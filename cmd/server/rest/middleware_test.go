@@ -0,0 +1,45 @@
+package rest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi"
+
+	"github.com/linushung/artemis/internal/pkg/faults"
+)
+
+func TestFaultMiddlewareMatchesRoutePattern(t *testing.T) {
+	faults.Init(faults.Config{Enabled: true})
+	err := faults.Get().SetRules([]faults.Rule{
+		{Name: "profiles", Target: faults.Inbound, Method: http.MethodGet, Pattern: "/api/profiles/{username}", Percentage: 100, Status: http.StatusServiceUnavailable},
+	})
+	if err != nil {
+		t.Fatalf("SetRules:: %v", err)
+	}
+	defer faults.Get().SetRules(nil)
+
+	ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }
+	router := chi.NewRouter()
+	router.Route("/api", func(r chi.Router) {
+		r = r.With(faultMiddleware)
+		r.Get("/profiles/{username}", ok)
+		r.Get("/users", ok)
+	})
+
+	tests := []struct {
+		path   string
+		status int
+	}{
+		{"/api/profiles/jake", http.StatusServiceUnavailable},
+		{"/api/users", http.StatusOK},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+		if w.Code != tt.status {
+			t.Errorf("status of %s = %d, want %d", tt.path, w.Code, tt.status)
+		}
+	}
+}
@@ -33,8 +33,8 @@ func (s *Server) createChiUser(w http.ResponseWriter, r *http.Request) {
 		Role: string(postgres.User),
 	}
 
-	if err := s.RDB.CreatePoster(*p); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	if err := s.RDB.CreatePoster(r.Context(), *p); err != nil {
+		writeError(w, err)
 		return
 	}
 
@@ -49,14 +49,9 @@ func (s *Server) loginChiUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	p, err := s.RDB.SelectPosterByEmail(req.Email)
+	p, err := s.RDB.SelectPosterByEmail(r.Context(), req.Email)
 	if err != nil {
-		status := http.StatusInternalServerError
-		if err.Error() == "sql: no rows in result set" {
-			status = http.StatusNotFound
-		}
-
-		http.Error(w, err.Error(), status)
+		writeError(w, err)
 		return
 	}
 
@@ -97,9 +92,9 @@ func (s *Server) updateChiUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	p, err := s.RDB.UpdatePoster(c.Subject, req)
+	p, err := s.RDB.UpdatePoster(r.Context(), c.Subject, req)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err)
 		return
 	}
 
@@ -115,9 +110,9 @@ func (s *Server) fetchCurrentChiUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	p, err := s.RDB.SelectPosterByEmail(c.Subject)
+	p, err := s.RDB.SelectPosterByEmail(r.Context(), c.Subject)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err)
 		return
 	}
 
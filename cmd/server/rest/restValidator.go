@@ -7,8 +7,6 @@ import (
 	"sync"
 
 	"github.com/go-playground/validator/v10"
-
-	log "github.com/sirupsen/logrus"
 )
 
 var (
@@ -35,13 +33,13 @@ func validateReq(body io.ReadCloser, request interface{}) error {
 
 	/* Ref: https://ahmet.im/blog/golang-json-decoder-pitfalls/ */
 	if err := json.NewDecoder(body).Decode(request); err != nil {
-		log.Errorf(ParseErrMsg, err)
+		logger.Errorf(ParseErrMsg, err)
 		return fmt.Errorf(ValidateErrMsg, err)
 	}
 
 	if errs := validate.Struct(request); errs != nil {
 		for _, err := range errs.(validator.ValidationErrors) {
-			log.Errorf(ParseErrMsg, err)
+			logger.Errorf(ParseErrMsg, err)
 			return fmt.Errorf(ValidateErrMsg, err)
 		}
 	}
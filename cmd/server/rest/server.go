@@ -1,22 +1,32 @@
 package rest
 
 import (
+	"context"
+	"errors"
 	"net/http"
 	_ "net/http/pprof"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/gin-contrib/pprof"
 	"github.com/go-chi/chi"
 	"github.com/go-chi/chi/middleware"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 
 	"github.com/linushung/artemis/cmd/server"
 	"github.com/linushung/artemis/internal/app/authorization"
-	"github.com/linushung/artemis/internal/pkg/configs"
+	"github.com/linushung/artemis/internal/app/database/postgres"
+	"github.com/linushung/artemis/internal/pkg/health"
+	"github.com/linushung/artemis/internal/pkg/logging"
 
 	"github.com/gin-gonic/gin"
-	log "github.com/sirupsen/logrus"
 )
 
+// logger is the logger of subsystem rest, whose level can be changed at runtime
+var logger = logging.Logger(logging.REST)
+
 const (
 	defaultReadTimeout  = 5 * time.Second
 	defaultWriteTimeout = 5 * time.Second
@@ -27,44 +37,96 @@ const (
 type Server struct {
 	server.BaseServer
 	Server http.Server
+	Health *health.Health
 }
 
-// InitRestServer run a HTTP server
+// InitRestServer run a HTTP server until SIGINT or SIGTERM is received, then shuts it down gracefully
 func InitRestServer(base server.BaseServer) {
 	/* Ref:
 	1. https://blog.cloudflare.com/the-complete-guide-to-golang-net-http-timeouts/
 	2. https://blog.cloudflare.com/exposing-go-on-the-internet/
 	3. https://medium.com/@simonfrey/go-as-in-golang-standard-net-http-config-will-break-your-production-environment-1360871cb72b
 	*/
-	srv := http.Server{
+	c := base.Config.Service
+	registerMetrics()
+	metricsSrv := serveMetrics(c.REST, c.Metrics)
+	s := &Server{BaseServer: base, Health: base.NewReadiness()}
+	s.Server = http.Server{
+		Addr:         c.REST.Addr(),
 		ReadTimeout:  defaultReadTimeout,
 		WriteTimeout: defaultWriteTimeout,
 		IdleTimeout:  defaultIdleTimeout,
 	}
-	router := createRouter(&Server{base, srv})
+	s.Server.Handler = createRouter(s, metricsSrv == nil)
+	srv := &s.Server
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		logger.Infof("***** [SERVER:REST] ***** Start a HTTP Server on port %d ......", c.REST.Port)
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Fatalf("***** [SERVER:REST][FAIL] ***** Failed to start HTTP Server: %v", err)
+		}
+	}()
+
+	<-ctx.Done()
+	stop()
+	shutdown(srv, metricsSrv, s.Health, c.Shutdown)
+	s.RDB.Close()
+}
+
+/*
+shutdown reports not-ready for Drain, so load balancers stop routing new requests to Artemis, then waits at most
+Timeout for in-flight requests to complete. The separate metrics server, if any, is shut down last so metrics of
+in-flight requests can still be scraped.
+*/
+func shutdown(srv, metricsSrv *http.Server, readiness *health.Health, c server.ShutdownConfig) {
+	readiness.Shutdown()
+	logger.Infof("***** [SERVER:REST] ***** Drain traffic for %s before shutting down ......", c.Drain)
+	time.Sleep(c.Drain)
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.Timeout)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		logger.Errorf("***** [SERVER:REST][FAIL] ***** Failed to shut down HTTP Server gracefully: %v", err)
+	} else {
+		logger.Infof("***** [SERVER:REST] ***** HTTP Server is shut down ......")
+	}
 
-	httpPort := configs.GetConfigStr("service.rest.port")
-	log.Infof("***** [SERVER:REST] ***** Start a HTTP Server on port %s ......", httpPort)
-	if err := http.ListenAndServe(httpPort, router); err != nil {
-		log.Fatalf("***** [SERVER:REST][FAIL] ***** Failed to start HTTP Server: %v", err)
+	if metricsSrv == nil {
+		return
 	}
+	if err := metricsSrv.Shutdown(ctx); err != nil {
+		logger.Errorf("***** [SERVER:METRICS][FAIL] ***** Failed to shut down metrics server gracefully: %v", err)
+		return
+	}
+	logger.Infof("***** [SERVER:METRICS] ***** Metrics server is shut down ......")
 }
 
-func createRouter(s *Server) *gin.Engine {
+// createRouter creates router of REST API, withMetrics mounts /metrics if metrics aren't served on a separate port
+func createRouter(s *Server, withMetrics bool) *gin.Engine {
 	/* Ref: https://github.com/gin-gonic/gin */
-	router := gin.Default()
+	router := gin.New()
+	router.Use(requestIDHandler(), accessLogHandler(), gin.Recovery())
+	router.Use(metricsHandler(), tracingHandler(), dbSessionHandler(), faultHandler())
 
 	/* Health Check */
 	router.GET("/ping", s.HTTPPing)
+	router.GET("/healthz", s.liveness)
+	router.GET("/readyz", s.readiness)
 	/* pprof */
 	pprof.Register(router, "/debug/pprof")
+	/* Prometheus */
+	if withMetrics {
+		router.GET("/metrics", gin.WrapH(promhttp.Handler()))
+	}
 
 	/* Hystrix */
 	hystrixGroup := router.Group("/hystrix")
 	{
 		hystrixGroup.POST("/ok", s.PostOK)
-		hystrixGroup.POST("/status/{code}", s.PostStatus)
-		hystrixGroup.POST("/delay/{second}", s.PostDelay)
+		hystrixGroup.POST("/status/:code", s.PostStatus)
+		hystrixGroup.POST("/delay/:second", s.PostDelay)
 	}
 
 	/* Artemis */
@@ -74,6 +136,22 @@ func createRouter(s *Server) *gin.Engine {
 		basicGroup.POST("/login", s.loginUser)
 	}
 
+	/* Admin */
+	adminGroup := router.Group("/admin")
+	adminGroup.Use(authorization.VerifyJWTHandler(s.JWTMgr), authorization.VerifyRoleHandler(string(postgres.Admin)))
+	{
+		adminGroup.GET("/db/stats", s.fetchDBStats)
+		adminGroup.GET("/circuitbreakers", s.listCircuitBreakers)
+		adminGroup.GET("/circuitbreakers/:register", s.fetchCircuitBreaker)
+		adminGroup.PUT("/circuitbreakers/:register/config", s.configureCircuitBreaker)
+		adminGroup.POST("/circuitbreakers/:register/:operation", s.controlCircuitBreaker)
+		adminGroup.GET("/faults", s.fetchFaults)
+		adminGroup.PUT("/faults", s.replaceFaults)
+		adminGroup.DELETE("/faults", s.clearFaults)
+		adminGroup.GET("/logging/levels", s.fetchLogLevels)
+		adminGroup.PUT("/logging/levels", s.changeLogLevel)
+	}
+
 	jwtAuth := router.Group("/api")
 	jwtAuth.Use(authorization.VerifyJWTHandler(s.JWTMgr))
 	{
@@ -103,13 +181,22 @@ func createRouter(s *Server) *gin.Engine {
 
 func createChiRouter(s *Server) *chi.Mux {
 	router := chi.NewRouter()
+	router.Use(requestIDMiddleware)
+	router.Use(accessLogMiddleware)
 	router.Use(middleware.Timeout(30 * time.Second))
 	router.Use(middleware.Recoverer)
+	router.Use(metricsMiddleware)
+	router.Use(tracingMiddleware)
+	router.Use(dbSessionMiddleware)
+	// faultMiddleware is registered per route, so route patterns are matched after routing
+	faulty := router.With(faultMiddleware)
 
 	/* Health Check */
 	// router.Get("/ping", s.HTTPPing)
+	faulty.Get("/healthz", s.livenessChi)
+	faulty.Get("/readyz", s.readinessChi)
 	/* pprof */
-	router.Mount("/debug", middleware.Profiler())
+	faulty.Mount("/debug", middleware.Profiler())
 
 	/* Hystrix */
 	// router.Post("/ok", s.PostOK)
@@ -118,6 +205,7 @@ func createChiRouter(s *Server) *chi.Mux {
 
 	/* Artemis */
 	router.Route("/api", func(r chi.Router) {
+		r = r.With(faultMiddleware)
 		r.Post("/users", s.createChiUser)
 		r.Post("/users/login", s.loginChiUser)
 		r.Put("/users", s.updateChiUser)
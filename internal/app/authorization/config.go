@@ -0,0 +1,37 @@
+package authorization
+
+import (
+	"time"
+
+	"github.com/linushung/artemis/internal/pkg/configs"
+)
+
+const (
+	defaultKeySize = 4096
+	minKeySize     = 2048
+)
+
+// Config represents "auth"
+type Config struct {
+	// KeySize is bits of the RSA key pair signing JWT
+	KeySize int `mapstructure:"keysize"`
+	// ValidPeriod is how long JWT is valid after it's issued
+	ValidPeriod time.Duration `mapstructure:"validperiod"`
+}
+
+// DefaultConfig returns Config of default values, which are kept for keys not set in configuration
+func DefaultConfig() Config {
+	return Config{KeySize: defaultKeySize, ValidPeriod: ValidPeriodMinute * time.Minute}
+}
+
+// Validate checks size of key and valid period of JWT
+func (c Config) Validate() error {
+	var errs configs.Errors
+	if c.KeySize < minKeySize {
+		errs.Addf("keysize", "must be at least %d bits, got %d", minKeySize, c.KeySize)
+	}
+	if c.ValidPeriod <= 0 {
+		errs.Addf("validperiod", "must be positive, got %s", c.ValidPeriod)
+	}
+	return errs.Err()
+}
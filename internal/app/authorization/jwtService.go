@@ -12,13 +12,19 @@ import (
 
 	"github.com/dgrijalva/jwt-go"
 	"github.com/gin-gonic/gin"
-	log "github.com/sirupsen/logrus"
+
+	"github.com/linushung/artemis/internal/pkg/logging"
 )
 
+// logger is the logger of subsystem jwt, whose level can be changed at runtime
+var logger = logging.Logger(logging.JWT)
+
 var (
 	once       sync.Once
 	instance   JWTMgr
 	privateKey *rsa.PrivateKey
+	// validPeriod is how long JWT is valid, see Config
+	validPeriod = ValidPeriodMinute * time.Minute
 )
 
 const (
@@ -49,18 +55,20 @@ type MockIdentityManager struct {
 	Type string
 }
 
-func InitJWTService() {
+// InitJWTService creates the key pair of JWT by c
+func InitJWTService(c Config) {
 	once.Do(func() {
 		instance = MockIdentityManager{"artemisJWT"}
 
 		// Use a single instance of Validate, it caches struct info
-		key, err := rsa.GenerateKey(rand.Reader, 4096)
+		key, err := rsa.GenerateKey(rand.Reader, c.KeySize)
 		if err != nil {
-			log.Fatalf("***** [JWT][FAIL] ***** Failed to create RSA key pair:: %s", err)
+			logger.Fatalf("***** [JWT][FAIL] ***** Failed to create RSA key pair:: %s", err)
 			os.Exit(1)
 		}
 
 		privateKey = key
+		validPeriod = c.ValidPeriod
 	})
 }
 
@@ -68,6 +76,11 @@ func GetJWTMgr() JWTMgr {
 	return instance
 }
 
+// KeyLoaded reports whether the RSA key pair signing and verifying JWT is loaded
+func KeyLoaded() bool {
+	return privateKey != nil
+}
+
 /* Ref: https://github.com/dgrijalva/jwt-go */
 func (mgr MockIdentityManager) GenerateJWT(c Claims) (string, error) {
 	issueTime := time.Now()
@@ -77,7 +90,7 @@ func (mgr MockIdentityManager) GenerateJWT(c Claims) (string, error) {
 		Role:     c.Role,
 		StandardClaims: jwt.StandardClaims{
 			Audience:  JwtClaimsAudience,
-			ExpiresAt: issueTime.Add(ValidPeriodMinute * time.Minute).Unix(),
+			ExpiresAt: issueTime.Add(validPeriod).Unix(),
 			Id:        c.Jti,
 			IssuedAt:  issueTime.Unix(),
 			Issuer:    JwtClaimsIssuer,
@@ -89,7 +102,7 @@ func (mgr MockIdentityManager) GenerateJWT(c Claims) (string, error) {
 	token := jwt.NewWithClaims(jwt.SigningMethodRS512, claims)
 	jtwStr, err := token.SignedString(privateKey)
 	if err != nil {
-		log.Errorf("***** [JWT][FAIL] ***** Failed to create JWT token:: %v", err)
+		logger.Errorf("***** [JWT][FAIL] ***** Failed to create JWT token:: %v", err)
 		return "", err
 	}
 
@@ -106,7 +119,7 @@ func (mgr MockIdentityManager) VerifyJWT(token string) (Claims, error) {
 		return &privateKey.PublicKey, nil
 	})
 	if err != nil {
-		log.Errorf("***** [JWT][FAIL] ***** Failed to verify JWT:: %v", err)
+		logger.Errorf("***** [JWT][FAIL] ***** Failed to verify JWT:: %v", err)
 		return Claims{}, err
 	}
 
@@ -120,8 +133,13 @@ func (mgr MockIdentityManager) VerifyJWT(token string) (Claims, error) {
 
 func VerifyJWTHandler(mgr JWTMgr) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
-		token := strings.Fields(ctx.Request.Header["Authorization"][0])[1]
-		c, err := mgr.VerifyJWT(token)
+		fields := strings.Fields(ctx.GetHeader("Authorization"))
+		if len(fields) != 2 {
+			ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{ "message": "missing bearer token" })
+			return
+		}
+
+		c, err := mgr.VerifyJWT(fields[1])
 		if err != nil {
 			ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{ "message": err.Error() })
 			return
@@ -132,6 +150,21 @@ func VerifyJWTHandler(mgr JWTMgr) gin.HandlerFunc {
 	}
 }
 
+// VerifyRoleHandler only allows requests whose JWT claims one of roles. It must be used after VerifyJWTHandler
+func VerifyRoleHandler(roles ...string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		c := ctx.MustGet("token").(Claims)
+		for _, r := range roles {
+			if c.Role == r {
+				ctx.Next()
+				return
+			}
+		}
+
+		ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{ "message": "insufficient role" })
+	}
+}
+
 /* https://tools.ietf.org/html/rfc7519#section-4.1 */
 /**
  * Reserved claims:
@@ -1,58 +1,76 @@
 package postgres
 
 import (
+	"context"
+	"time"
+
 	"github.com/google/uuid"
-	log "github.com/sirupsen/logrus"
 )
 
-func (rdb *RDB) SelectArticleById(id uuid.UUID) (Article, error) {
+func (rdb *RDB) SelectArticleById(ctx context.Context, id uuid.UUID) (Article, error) {
+	defer observeQuery("SelectArticleById", time.Now())
+
 	a := Article{}
 	statement := `SELECT * FROM article WHERE id = ?;`
-	statement = rdb.Poolx.Rebind(statement)
 
-	if err := rdb.Poolx.Get(&a, statement, id); err != nil {
-		log.Errorf("***** [POSTGRES:%s][FAIL] ***** Cannot execute SELECT operation:: %v", "SelectArticleById", err)
-		return a, err
+	if err := rdb.getContext(ctx, &a, statement, id); err != nil {
+		logger.WithContext(ctx).Errorf("***** [POSTGRES:%s][FAIL] ***** Cannot execute SELECT operation:: %v", "SelectArticleById", err)
+		return a, translateError(err)
 	}
 
 	return a, nil
 }
 
-func (rdb *RDB) CreateArticle(id uuid.UUID, article Article) (Article, error) {
-	articleStmt := `INSERT INTO article (id, slug, title, description, body) VALUES (?,?,?,?,?);`
-	articleStmt = rdb.Poolx.Rebind(articleStmt)
-
-	_, err := rdb.Poolx.Exec(articleStmt,
-		id,
-		article.Slug,
-		article.Title,
-		article.Description,
-		article.Body,
-	)
-	if err != nil {
-		log.Errorf("***** [POSTGRES:%s][FAIL] ***** Cannot execute INSERT operation:: %v", "CreateArticle", err)
-		return Article{}, err
-	}
+// CreateArticle inserts an article together with its tags in a single transaction
+func (rdb *RDB) CreateArticle(ctx context.Context, id uuid.UUID, article Article) (Article, error) {
+	defer observeQuery("CreateArticle", time.Now())
+
+	a := Article{}
+	err := rdb.transactionHandler(ctx, "CreateArticle", func(ctx context.Context) error {
+		articleStmt := `INSERT INTO article (id, slug, title, description, body) VALUES (?,?,?,?,?);`
 
-	a, err := rdb.SelectArticleById(id)
+		_, err := rdb.execContext(ctx, articleStmt,
+			id,
+			article.Slug,
+			article.Title,
+			article.Description,
+			article.Body,
+		)
+		if err != nil {
+			logger.WithContext(ctx).Errorf("***** [POSTGRES:%s][FAIL] ***** Cannot execute INSERT operation:: %v", "CreateArticle", err)
+			return translateError(err)
+		}
+
+		a, err = rdb.SelectArticleById(ctx, id)
+		if err != nil {
+			logger.WithContext(ctx).Errorf("***** [POSTGRES:%s][FAIL] ***** Cannot execute SELECT operation:: %v", "CreateArticle", err)
+			return err
+		}
+
+		return rdb.TagArticle(ctx, a.TagId, article.Tags)
+	})
 	if err != nil {
-		log.Errorf("***** [POSTGRES:%s][FAIL] ***** Cannot execute SELECT operation:: %v", "CreateArticle", err)
 		return Article{}, err
 	}
 
+	a.Tags = article.Tags
 	return a, nil
 }
 
-func (rdb *RDB) TagArticle(id int64, tags []string) error {
-	for _, t := range tags {
-		tagStmt := `INSERT INTO tag (id, tag) VALUES (?,?);`
-		tagStmt = rdb.Poolx.Rebind(tagStmt)
+// TagArticle inserts all tags of an article or none of them
+func (rdb *RDB) TagArticle(ctx context.Context, id int64, tags []string) error {
+	defer observeQuery("TagArticle", time.Now())
 
-		if _, err := rdb.Poolx.Exec(tagStmt, id, t); err != nil {
-			log.Errorf("***** [POSTGRES:%s][FAIL] ***** Cannot execute INSERT operation:: %v", "TagArticle", err)
-			return err
+	return rdb.transactionHandler(ctx, "TagArticle", func(ctx context.Context) error {
+		for _, t := range tags {
+			tagStmt := `INSERT INTO tag (id, tag) VALUES (?,?);`
+
+			if _, err := rdb.execContext(ctx, tagStmt, id, t); err != nil {
+				logger.WithContext(ctx).Errorf("***** [POSTGRES:%s][FAIL] ***** Cannot execute INSERT operation:: %v", "TagArticle", err)
+				return translateError(err)
+			}
 		}
-	}
 
-	return nil
+		return nil
+	})
 }
@@ -1,20 +1,26 @@
 package postgres
 
 import (
+	"context"
 	/* Ref: http://go-database-sql.org/index.html */
 	"database/sql"
 	"fmt"
+	"net/url"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/linushung/artemis/internal/pkg/configs"
+	"github.com/linushung/artemis/internal/pkg/logging"
 	/* Ref: http://jmoiron.github.io/sqlx/ */
 	"github.com/jmoiron/sqlx"
 	// import postgres Driver for database/sql package
 	_ "github.com/lib/pq"
-	log "github.com/sirupsen/logrus"
 )
 
+// logger is the logger of subsystem postgres, whose level can be changed at runtime
+var logger = logging.Logger(logging.Postgres)
+
 type RDB struct {
 	Type string
 	Host string
@@ -27,69 +33,291 @@ type RDB struct {
 	*/
 	Pool  *sql.DB
 	Poolx *sqlx.DB
+	// StatementTimeout is the default deadline of each statement if the request context has no earlier deadline
+	StatementTimeout time.Duration
+	replicas         *replicaSet
+}
+
+const (
+	dbType                      = "PostgreSQL"
+	defaultMaxOpenConns         = 5
+	defaultMaxIdleConns         = 5
+	defaultConnMaxLifetime      = time.Hour
+	defaultConnMaxIdleTime      = 10 * time.Minute
+	defaultSSLMode              = "disable"
+	defaultRetryMaxAttempts     = 5
+	defaultRetryInitialInterval = time.Second
+	defaultRetryMaxInterval     = 30 * time.Second
+)
+
+// Config represents "connection.rdb"
+type Config struct {
+	Type     string `mapstructure:"type"`
+	Username string `mapstructure:"username"`
+	Password string `mapstructure:"password"`
+	// Host is host and port of primary, e.g. "127.0.0.1:5432"
+	Host     string `mapstructure:"host"`
+	Database string `mapstructure:"database"`
+	// StatementTimeout is the default deadline of each statement, 0 means no deadline
+	StatementTimeout time.Duration `mapstructure:"statementtimeout"`
+	PoolConfig       `mapstructure:",squash"`
+	// SSLMode is one of "disable", "require", "verify-ca" and "verify-full"
+	SSLMode     string `mapstructure:"sslmode"`
+	SSLRootCert string `mapstructure:"sslrootcert"`
+	SSLCert     string `mapstructure:"sslcert"`
+	SSLKey      string `mapstructure:"sslkey"`
+	// Replicas are hosts of read-only replicas sharing credentials and pool settings of primary
+	Replicas              []string      `mapstructure:"replicas"`
+	ReplicaHealthInterval time.Duration `mapstructure:"replicahealthinterval"`
+	Retry                 RetryConfig   `mapstructure:"retry"`
+}
+
+// PoolConfig represents the settings of connection pool under "connection.rdb"
+type PoolConfig struct {
+	MaxOpenConns    int           `mapstructure:"maxopenconns"`
+	MaxIdleConns    int           `mapstructure:"maxidleconns"`
+	ConnMaxLifetime time.Duration `mapstructure:"connmaxlifetime"`
+	ConnMaxIdleTime time.Duration `mapstructure:"connmaxidletime"`
+}
+
+// RetryConfig represents the bounded exponential backoff of connecting to database at startup
+type RetryConfig struct {
+	MaxAttempts     int           `mapstructure:"maxattempts"`
+	InitialInterval time.Duration `mapstructure:"initialinterval"`
+	MaxInterval     time.Duration `mapstructure:"maxinterval"`
+}
+
+// DefaultConfig returns Config of default values, which are kept for keys not set in configuration
+func DefaultConfig() Config {
+	return Config{
+		Type: dbType,
+		PoolConfig: PoolConfig{
+			MaxOpenConns:    defaultMaxOpenConns,
+			MaxIdleConns:    defaultMaxIdleConns,
+			ConnMaxLifetime: defaultConnMaxLifetime,
+			ConnMaxIdleTime: defaultConnMaxIdleTime,
+		},
+		SSLMode:               defaultSSLMode,
+		ReplicaHealthInterval: defaultReplicaHealthInterval,
+		Retry: RetryConfig{
+			MaxAttempts:     defaultRetryMaxAttempts,
+			InitialInterval: defaultRetryInitialInterval,
+			MaxInterval:     defaultRetryMaxInterval,
+		},
+	}
+}
+
+// Validate checks required fields, SSL mode, duplicated replicas and ranges of pool and retry settings
+func (c Config) Validate() error {
+	var errs configs.Errors
+	if c.Type != dbType {
+		errs.Addf("type", "only %s is supported, got %q", dbType, c.Type)
+	}
+	for key, v := range map[string]string{"host": c.Host, "database": c.Database, "username": c.Username} {
+		if v == "" {
+			errs.Addf(key, "is required")
+		}
+	}
+	switch c.SSLMode {
+	case "disable", "require", "verify-ca", "verify-full":
+	default:
+		errs.Addf("sslmode", "must be one of disable, require, verify-ca and verify-full, got %q", c.SSLMode)
+	}
+	for key, v := range map[string]int{"maxopenconns": c.MaxOpenConns, "maxidleconns": c.MaxIdleConns} {
+		if v < 0 {
+			errs.Addf(key, "must not be negative, got %d", v)
+		}
+	}
+	for key, v := range map[string]time.Duration{
+		"statementtimeout": c.StatementTimeout,
+		"connmaxlifetime":  c.ConnMaxLifetime,
+		"connmaxidletime":  c.ConnMaxIdleTime,
+	} {
+		if v < 0 {
+			errs.Addf(key, "must not be negative, got %s", v)
+		}
+	}
+	seen := map[string]bool{}
+	for n, host := range c.Replicas {
+		switch {
+		case host == "":
+			errs.Addf(fmt.Sprintf("replicas[%d]", n), "is empty")
+		case seen[strings.ToLower(host)]:
+			// Statistics of connection pools are exported per host, see registerMetrics
+			errs.Addf(fmt.Sprintf("replicas[%d]", n), "duplicates replica %s", host)
+		}
+		seen[strings.ToLower(host)] = true
+	}
+	if len(c.Replicas) > 0 && c.ReplicaHealthInterval <= 0 {
+		errs.Addf("replicahealthinterval", "must be positive, got %s", c.ReplicaHealthInterval)
+	}
+	if c.Retry.MaxAttempts < 1 {
+		errs.Addf("retry.maxattempts", "must be at least 1, got %d", c.Retry.MaxAttempts)
+	}
+	if c.Retry.InitialInterval <= 0 {
+		errs.Addf("retry.initialinterval", "must be positive, got %s", c.Retry.InitialInterval)
+	}
+	if c.Retry.MaxInterval < c.Retry.InitialInterval {
+		errs.Addf("retry.maxinterval", "must not be less than initialinterval, got %s", c.Retry.MaxInterval)
+	}
+	return errs.Err()
+}
+
+/* Ref: https://www.postgresql.org/docs/current/libpq-connect.html#LIBPQ-CONNSTRING */
+// dataSourceName builds the connection URI of PostgreSQL of host with credentials and SSL settings of c
+func dataSourceName(c Config, host string) string {
+	q := url.Values{}
+	q.Set("sslmode", c.SSLMode)
+	for k, v := range map[string]string{"sslrootcert": c.SSLRootCert, "sslcert": c.SSLCert, "sslkey": c.SSLKey} {
+		if v != "" {
+			q.Set(k, v)
+		}
+	}
+
+	dsn := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(c.Username, c.Password),
+		Host:     host,
+		Path:     c.Database,
+		RawQuery: q.Encode(),
+	}
+	return dsn.String()
 }
 
-// InitPostgreSQL create an abstraction representing a Database (*sqlx.DB) and verify with a ping
-func InitPostgreSQL() RDB {
-	dbType := "PostgreSQL"
+/*
+connectWithRetry keeps connecting to database with bounded exponential backoff, so Artemis can wait for PostgreSQL
+which is not up yet during rollouts instead of crashing immediately.
+*/
+func connectWithRetry(host, dsn string, r RetryConfig) (*sqlx.DB, error) {
+	interval := r.InitialInterval
+	for attempt := 1; ; attempt++ {
+		connsPool, err := sqlx.Connect("postgres", dsn)
+		if err == nil {
+			return connsPool, nil
+		}
+		if attempt >= r.MaxAttempts {
+			return nil, err
+		}
 
-	host := configs.GetConfigStr("connection.rdb.host")
-	username := configs.GetConfigStr("connection.rdb.username")
-	password := configs.GetConfigStr("connection.rdb.password")
-	db := configs.GetConfigStr("connection.rdb.database")
+		logger.Warnf("***** [DATABASE][RETRY] ***** Failed to connect to PostgreSQL::%s (attempt %d/%d), retry in %s:: %v",
+			host, attempt, r.MaxAttempts, interval, err)
+		time.Sleep(interval)
+		if interval *= 2; interval > r.MaxInterval {
+			interval = r.MaxInterval
+		}
+	}
+}
 
-	connsPool, err := sqlx.Connect("postgres", fmt.Sprintf("postgres://%s:%s@%s/%s?sslmode=disable", username, password, host, db))
+// InitPostgreSQL create an abstraction representing a Database (*sqlx.DB) of c and verify with a ping
+func InitPostgreSQL(c Config) RDB {
+	connsPool, err := connectWithRetry(c.Host, dataSourceName(c, c.Host), c.Retry)
 	if err != nil {
-		log.Fatalf("***** [DATABASE][FAIL] ***** Failed to create connection to PostgreSQL::%s %s", host, err)
+		logger.Fatalf("***** [DATABASE][FAIL] ***** Failed to create connection to PostgreSQL::%s after %d attempts:: %v", c.Host, c.Retry.MaxAttempts, err)
 		os.Exit(1)
 	}
 
-	/* Ref: https://www.alexedwards.net/blog/configuring-sqldb */
-	/* Set the maximum number of concurrently open connections (in-use + idle) to 5. Setting this to less than or equal
+	configurePool(connsPool, c.PoolConfig)
+	logger.Infof("***** [DATABASE:%s] ***** Create connections to PostgreSQL::%s with pool %+v!", c.Type, c.Host, c.PoolConfig)
+
+	rdb := RDB{
+		Type:             c.Type,
+		Host:             c.Host,
+		Poolx:            connsPool,
+		StatementTimeout: c.StatementTimeout,
+		replicas:         initReplicas(c),
+	}
+	registerMetrics(rdb)
+	return rdb
+}
+
+/* Ref: https://www.alexedwards.net/blog/configuring-sqldb */
+func configurePool(connsPool *sqlx.DB, c PoolConfig) {
+	/* Set the maximum number of concurrently open connections (in-use + idle). Setting this to less than or equal
 	to 0 will mean there is no maximum limit. (Default setting is no limit) */
-	connsPool.SetMaxOpenConns(5)
-	/* Set the maximum number of concurrently idle connections to 5. Setting this to less than or equal to 0 will mean
+	connsPool.SetMaxOpenConns(c.MaxOpenConns)
+	/* Set the maximum number of concurrently idle connections. Setting this to less than or equal to 0 will mean
 	that no idle connections are retained. (Default setting is 2)
 	MaxIdleConns should always be less than or equal to MaxOpenConns. Go enforces this and will automatically reduce
 	MaxIdleConns if necessary.*/
-	connsPool.SetMaxIdleConns(5)
-	/* Set the maximum lifetime of a connection to 1 hour. Setting it to 0 means that there is no maximum lifetime and
+	connsPool.SetMaxIdleConns(c.MaxIdleConns)
+	/* Set the maximum lifetime of a connection. Setting it to 0 means that there is no maximum lifetime and
 	the connection is reused forever (Default setting is no limit). */
-	connsPool.SetConnMaxLifetime(time.Hour)
-	log.Infof("***** [DATABASE:%s] ***** Create connections to PostgreSQL::%s!", dbType, host)
+	connsPool.SetConnMaxLifetime(c.ConnMaxLifetime)
+	/* Set the maximum amount of time a connection may be idle before being closed. Setting it to 0 means that
+	connections are not closed due to idle time. */
+	connsPool.SetConnMaxIdleTime(c.ConnMaxIdleTime)
+}
 
-	return RDB{
-		Type:  dbType,
-		Host:  host,
-		Poolx: connsPool,
+// Stats returns statistics of connection pool
+func (rdb *RDB) Stats() sql.DBStats {
+	return rdb.Poolx.Stats()
+}
+
+// Close closes connection pools of replicas and primary, so it should only be called when shutting down
+func (rdb *RDB) Close() {
+	rdb.replicas.Close()
+	if err := rdb.Poolx.Close(); err != nil {
+		logger.Errorf("***** [DATABASE][FAIL] ***** Failed to close connection to PostgreSQL::%s %v", rdb.Host, err)
+		return
 	}
+	logger.Infof("***** [DATABASE:%s] ***** Close connections to PostgreSQL::%s!", rdb.Type, rdb.Host)
 }
 
-func (rdb *RDB) transactionHandler(ops string, block func(tx *sqlx.Tx)) error {
-	tx, err := rdb.Poolx.Beginx()
-	if err != nil {
-		log.Errorf("***** [POSTGRES:%s][FAIL] ***** Cannot execute BEGIN(Transaction) operation:: %#v", ops, err)
+// Ping verifies a connection to primary is still alive, establishing a connection if necessary
+func (rdb *RDB) Ping(ctx context.Context) error {
+	return rdb.Poolx.PingContext(ctx)
+}
+
+/*
+queryContext derives the context of a single statement from the context of request, so a statement is cancelled when
+either the client abandons the request or the default statement timeout elapses.
+*/
+func (rdb *RDB) queryContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if rdb.StatementTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithTimeout(ctx, rdb.StatementTimeout)
+}
+
+// getContext and selectContext execute read-only queries which may be routed to replicas
+func (rdb *RDB) getContext(ctx context.Context, dest interface{}, statement string, args ...interface{}) (err error) {
+	ctx, span := startSpan(ctx, statement)
+	defer func() { endSpan(span, err) }()
+	ctx, cancel := rdb.queryContext(ctx)
+	defer cancel()
+	if err = injectFault(ctx, faultRead, statement); err != nil {
 		return err
 	}
 
-	defer recoverTransaction(ops, tx)
-	block(tx)
+	conn := rdb.reader(ctx)
+	return sqlx.GetContext(ctx, conn, dest, conn.Rebind(statement), args...)
+}
 
-	if err := tx.Commit(); err != nil {
-		log.Errorf("***** [POSTGRES:%s][FAIL] ***** Cannot execute COMMIT(Transaction) operations:: %#v", ops, err)
+func (rdb *RDB) selectContext(ctx context.Context, dest interface{}, statement string, args ...interface{}) (err error) {
+	ctx, span := startSpan(ctx, statement)
+	defer func() { endSpan(span, err) }()
+	ctx, cancel := rdb.queryContext(ctx)
+	defer cancel()
+	if err = injectFault(ctx, faultRead, statement); err != nil {
 		return err
 	}
 
-	return nil
+	conn := rdb.reader(ctx)
+	return sqlx.SelectContext(ctx, conn, dest, conn.Rebind(statement), args...)
 }
 
-/* Ref:
-1. https://blog.golang.org/defer-panic-and-recover
-2. https://eli.thegreenplace.net/2018/on-the-uses-and-misuses-of-panics-in-go/
-*/
-func recoverTransaction(ops string, tx *sqlx.Tx) {
-	if p := recover(); p != nil {
-		log.Errorf("***** [PANIC:%s] ***** Capture PANIC during DB Transaction:: %#v", ops, p)
-		tx.Rollback()
+// execContext executes statements on primary and makes the following reads of the session stay on primary
+func (rdb *RDB) execContext(ctx context.Context, statement string, args ...interface{}) (res sql.Result, err error) {
+	ctx, span := startSpan(ctx, statement)
+	defer func() { endSpan(span, err) }()
+	ctx, cancel := rdb.queryContext(ctx)
+	defer cancel()
+	if err = injectFault(ctx, faultWrite, statement); err != nil {
+		return nil, err
 	}
+
+	markWritten(ctx)
+	conn := rdb.conn(ctx)
+	return conn.ExecContext(ctx, conn.Rebind(statement), args...)
 }
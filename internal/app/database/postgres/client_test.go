@@ -0,0 +1,34 @@
+package postgres
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestConfigValidateReplicas(t *testing.T) {
+	tests := []struct {
+		name     string
+		replicas []string
+		err      string
+	}{
+		{"none", nil, ""},
+		{"distinct", []string{"replica-1:5432", "replica-2:5432"}, ""},
+		{"empty", []string{"replica-1:5432", ""}, "replicas[1]: is empty"},
+		{"duplicated", []string{"replica-1:5432", "replica-2:5432", "Replica-1:5432"}, "replicas[2]: duplicates replica Replica-1:5432"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := DefaultConfig()
+			c.Host, c.Database, c.Username = "primary:5432", "artemis", "artemis"
+			c.Replicas = tt.replicas
+
+			err := c.Validate()
+			if tt.err == "" && err != nil {
+				t.Errorf("Validate = %v, want nil", err)
+			}
+			if tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+				t.Errorf("Validate = %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/lib/pq"
+)
+
+/*
+Domain errors of storage layer. Callers should compare with errors.Is() instead of matching error messages because
+the returned error wraps the original driver error for logging.
+*/
+var (
+	ErrNotFound  = errors.New("resource not found")
+	ErrConflict  = errors.New("resource already exists")
+	ErrForbidden = errors.New("operation is forbidden")
+	ErrTimeout   = errors.New("operation timed out or was cancelled")
+)
+
+/* Ref: https://www.postgresql.org/docs/current/errcodes-appendix.html */
+const (
+	uniqueViolation       = "unique_violation"
+	foreignKeyViolation   = "foreign_key_violation"
+	insufficientPrivilege = "insufficient_privilege"
+	queryCanceled         = "query_canceled"
+)
+
+// translateError converts errors returned by database/sql and PostgreSQL driver into domain errors
+func translateError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("%w: %v", ErrNotFound, err)
+	}
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		return fmt.Errorf("%w: %v", ErrTimeout, err)
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		switch pqErr.Code.Name() {
+		case uniqueViolation:
+			return fmt.Errorf("%w: %s", ErrConflict, pqErr.Detail)
+		case foreignKeyViolation:
+			return fmt.Errorf("%w: %s", ErrNotFound, pqErr.Detail)
+		case insufficientPrivilege:
+			return fmt.Errorf("%w: %s", ErrForbidden, pqErr.Message)
+		case queryCanceled:
+			return fmt.Errorf("%w: %s", ErrTimeout, pqErr.Message)
+		}
+	}
+
+	return err
+}
@@ -0,0 +1,40 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/linushung/artemis/internal/pkg/faults"
+)
+
+// Kinds of statements matched against Method of rules of fault injection
+const (
+	faultRead  = "read"
+	faultWrite = "write"
+)
+
+// injectFault delays statement or fails it with domain error by the matching rule of fault injection
+func injectFault(ctx context.Context, kind, statement string) error {
+	r, ok := faults.Get().Match(faults.DB, kind, statement)
+	if !ok {
+		return nil
+	}
+	if err := r.Wait(ctx); err != nil {
+		return err
+	}
+
+	switch r.Error {
+	case faults.ErrorTimeout:
+		return fmt.Errorf("%w: injected by rule %s", ErrTimeout, r.Name)
+	case faults.ErrorNotFound:
+		return fmt.Errorf("%w: injected by rule %s", ErrNotFound, r.Name)
+	case faults.ErrorConflict:
+		return fmt.Errorf("%w: injected by rule %s", ErrConflict, r.Name)
+	case faults.ErrorForbidden:
+		return fmt.Errorf("%w: injected by rule %s", ErrForbidden, r.Name)
+	case faults.ErrorInternal:
+		return fmt.Errorf("internal error injected by rule %s", r.Name)
+	default:
+		return nil
+	}
+}
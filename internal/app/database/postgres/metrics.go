@@ -0,0 +1,30 @@
+package postgres
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+)
+
+var queryLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	Namespace: "artemis",
+	Subsystem: "db",
+	Name:      "query_duration_seconds",
+	Help:      "Latency of repository methods including all of their statements.",
+	Buckets:   []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+}, []string{"method"})
+
+/* Ref: https://pkg.go.dev/github.com/prometheus/client_golang/prometheus/collectors#NewDBStatsCollector */
+// registerMetrics exports query latency and statistics of connection pools of primary and replicas
+func registerMetrics(rdb RDB) {
+	prometheus.MustRegister(queryLatency, collectors.NewDBStatsCollector(rdb.Poolx.DB, "primary"))
+	for _, r := range rdb.replicas.replicas {
+		prometheus.MustRegister(collectors.NewDBStatsCollector(r.db.DB, r.host))
+	}
+}
+
+// observeQuery records latency of repository method since start, e.g. defer observeQuery("CreatePoster", time.Now())
+func observeQuery(method string, start time.Time) {
+	queryLatency.WithLabelValues(method).Observe(time.Since(start).Seconds())
+}
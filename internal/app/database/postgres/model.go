@@ -19,6 +19,9 @@ type Poster struct {
 	Image    string `json:"image omitempty"`
 	Bio      string `json:"bio omitempty"`
 	Token    string `json:"-"`
+
+	FollowersCount int `json:"followersCount" db:"followers_count"`
+	FollowingCount int `json:"followingCount" db:"following_count"`
 }
 
 type Follower struct {
@@ -1,126 +1,171 @@
 package postgres
 
 import (
-	"errors"
+	"context"
 	"fmt"
-
-	log "github.com/sirupsen/logrus"
+	"time"
 )
 
 /* Ref: https://www.alexedwards.net/blog/practical-persistence-sql */
-func (rdb *RDB) CreatePoster(p Poster) error {
+func (rdb *RDB) CreatePoster(ctx context.Context, p Poster) error {
+	defer observeQuery("CreatePoster", time.Now())
+
 	statement := `INSERT INTO poster (email, username, password, role) VALUES (?,?,?,?);`
-	statement = rdb.Poolx.Rebind(statement)
 
-	_, err := rdb.Poolx.Exec(statement,
+	_, err := rdb.execContext(ctx, statement,
 		p.Email,
 		p.Username,
 		p.Password,
 		p.Role,
 	)
 	if err != nil {
-		log.Errorf("***** [POSTGRES:%s][FAIL] ***** Cannot execute INSERT operation:: %v", "CreatePoster", err)
-		return err
+		logger.WithContext(ctx).Errorf("***** [POSTGRES:%s][FAIL] ***** Cannot execute INSERT operation:: %v", "CreatePoster", err)
+		return translateError(err)
 	}
 
 	return nil
 }
 
-func (rdb *RDB) SelectPosterByEmail(email string) (Poster, error) {
+func (rdb *RDB) SelectPosterByEmail(ctx context.Context, email string) (Poster, error) {
+	defer observeQuery("SelectPosterByEmail", time.Now())
+
 	p := &Poster{}
-	statement := `SELECT email, username, password, role, bio, image FROM poster WHERE email = ?;`
-	statement = rdb.Poolx.Rebind(statement)
+	statement := `SELECT email, username, password, role, bio, image, followers_count, following_count FROM poster WHERE email = ?;`
 
-	if err := rdb.Poolx.Get(p, statement, email); err != nil {
-		log.Errorf("***** [POSTGRES:%s][FAIL] ***** Cannot execute SELECT operation:: %v", "SelectPosterByEmail", err)
-		return *p, err
+	if err := rdb.getContext(ctx, p, statement, email); err != nil {
+		logger.WithContext(ctx).Errorf("***** [POSTGRES:%s][FAIL] ***** Cannot execute SELECT operation:: %v", "SelectPosterByEmail", err)
+		return *p, translateError(err)
 	}
 
 	return *p, nil
 }
 
-func (rdb *RDB) SelectPosterByUsername(username string) (Poster, error) {
+func (rdb *RDB) SelectPosterByUsername(ctx context.Context, username string) (Poster, error) {
+	defer observeQuery("SelectPosterByUsername", time.Now())
+
 	p := &Poster{}
-	statement := `SELECT email, username, password, role, bio, image FROM poster WHERE username = ?;`
-	statement = rdb.Poolx.Rebind(statement)
+	statement := `SELECT email, username, password, role, bio, image, followers_count, following_count FROM poster WHERE username = ?;`
 
-	if err := rdb.Poolx.Get(p, statement, username); err != nil {
-		log.Errorf("***** [POSTGRES:%s][FAIL] ***** Cannot execute SELECT operation:: %v", "SelectPosterByUsername", err)
-		return *p, err
+	if err := rdb.getContext(ctx, p, statement, username); err != nil {
+		logger.WithContext(ctx).Errorf("***** [POSTGRES:%s][FAIL] ***** Cannot execute SELECT operation:: %v", "SelectPosterByUsername", err)
+		return *p, translateError(err)
 	}
 
 	return *p, nil
 }
 
-func (rdb *RDB) UpdatePoster(email string, r *UpdateReq) (Poster, error) {
-	p, err := rdb.SelectPosterByEmail(email)
-	if err != nil {
-		log.Errorf("***** [POSTGRES:%s][FAIL] ***** Cannot execute SELECT operation:: %v", "UpdatePoster", err)
-		return Poster{}, err
-	}
-
-	if r.Password != "" {
-		p.Password = r.Password
-	}
-	if r.Username != "" {
-		p.Username = r.Username
-	}
-	if r.Image != "" {
-		p.Image = r.Image
-	}
-	if r.Bio != "" {
-		p.Bio = r.Bio
-	}
-
-	statement := `UPDATE poster SET email = ?, username = ?, password = ?, image = ? , bio = ? WHERE email = ?;`
-	statement = rdb.Poolx.Rebind(statement)
-	_, err = rdb.Poolx.Exec(statement, p.Email, p.Username, p.Password, p.Image, p.Bio, p.Email)
+/*
+UpdatePoster locks the row of poster before applying the update. Username is referenced by follower table, hence a
+renamed poster also renames its following records in the same transaction.
+*/
+func (rdb *RDB) UpdatePoster(ctx context.Context, email string, r *UpdateReq) (Poster, error) {
+	defer observeQuery("UpdatePoster", time.Now())
+
+	p := Poster{}
+	err := rdb.transactionHandler(ctx, "UpdatePoster", func(ctx context.Context) error {
+		statement := `SELECT email, username, password, role, bio, image, followers_count, following_count FROM poster WHERE email = ? FOR UPDATE;`
+		if err := rdb.getContext(ctx, &p, statement, email); err != nil {
+			logger.WithContext(ctx).Errorf("***** [POSTGRES:%s][FAIL] ***** Cannot execute SELECT operation:: %v", "UpdatePoster", err)
+			return translateError(err)
+		}
+
+		username := p.Username
+		if r.Password != "" {
+			p.Password = r.Password
+		}
+		if r.Username != "" {
+			p.Username = r.Username
+		}
+		if r.Image != "" {
+			p.Image = r.Image
+		}
+		if r.Bio != "" {
+			p.Bio = r.Bio
+		}
+
+		statement = `UPDATE poster SET email = ?, username = ?, password = ?, image = ? , bio = ? WHERE email = ?;`
+		if _, err := rdb.execContext(ctx, statement, p.Email, p.Username, p.Password, p.Image, p.Bio, p.Email); err != nil {
+			logger.WithContext(ctx).Errorf("***** [POSTGRES:%s][FAIL] ***** Cannot execute UPDATE operation:: %v", "UpdatePoster", err)
+			return translateError(err)
+		}
+
+		if username != p.Username {
+			statement = `UPDATE follower SET follower = ? WHERE follower = ?;`
+			if _, err := rdb.execContext(ctx, statement, p.Username, username); err != nil {
+				logger.WithContext(ctx).Errorf("***** [POSTGRES:%s][FAIL] ***** Cannot execute UPDATE operation:: %v", "UpdatePoster", err)
+				return translateError(err)
+			}
+		}
+
+		return nil
+	})
 	if err != nil {
-		log.Errorf("***** [POSTGRES:%s][FAIL] ***** Cannot execute UPDATE operation:: %v", "UpdatePoster", err)
 		return Poster{}, err
 	}
 
 	return p, nil
 }
 
-func (rdb *RDB) FetchFollowersByEmail(email string) ([]string, error) {
+func (rdb *RDB) FetchFollowersByEmail(ctx context.Context, email string) ([]string, error) {
+	defer observeQuery("FetchFollowersByEmail", time.Now())
+
 	var f []string
 	statement := `SELECT follower FROM follower WHERE email = ?;`
-	statement = rdb.Poolx.Rebind(statement)
 
-	if err := rdb.Poolx.Select(&f, statement, email); err != nil {
-		log.Errorf("***** [POSTGRES:%s][FAIL] ***** Cannot execute SELECT operation:: %v", "SelectPosterByUsername", err)
-		return f, err
+	if err := rdb.selectContext(ctx, &f, statement, email); err != nil {
+		logger.WithContext(ctx).Errorf("***** [POSTGRES:%s][FAIL] ***** Cannot execute SELECT operation:: %v", "FetchFollowersByEmail", err)
+		return f, translateError(err)
 	}
 
 	return f, nil
 }
 
-func (rdb *RDB) FollowPoster(poster string, follower string) error {
-	statement := `INSERT INTO follower (email, follower) VALUES (?,?);`
-	statement = rdb.Poolx.Rebind(statement)
+// FollowPoster inserts a following record and increases the counters of both posters in a single transaction
+func (rdb *RDB) FollowPoster(ctx context.Context, poster string, follower string) error {
+	defer observeQuery("FollowPoster", time.Now())
 
-	_, err := rdb.Poolx.Exec(statement, poster, follower)
-	if err != nil {
-		log.Errorf("***** [POSTGRES:%s][FAIL] ***** Cannot execute INSERT operation:: %v", "CreatePoster", err)
-		return err
-	}
+	return rdb.transactionHandler(ctx, "FollowPoster", func(ctx context.Context) error {
+		statement := `INSERT INTO follower (email, follower) VALUES (?,?);`
+		if _, err := rdb.execContext(ctx, statement, poster, follower); err != nil {
+			logger.WithContext(ctx).Errorf("***** [POSTGRES:%s][FAIL] ***** Cannot execute INSERT operation:: %v", "FollowPoster", err)
+			return translateError(err)
+		}
 
-	return nil
+		return rdb.updateFollowCounters(ctx, "FollowPoster", poster, follower, 1)
+	})
 }
 
-func (rdb *RDB) UnFollowPoster(email string, follower string) error {
-	statement := `DELETE FROM follower WHERE email = ? AND follower = ?;`
-	statement = rdb.Poolx.Rebind(statement)
+// UnFollowPoster deletes a following record and decreases the counters of both posters in a single transaction
+func (rdb *RDB) UnFollowPoster(ctx context.Context, email string, follower string) error {
+	defer observeQuery("UnFollowPoster", time.Now())
+
+	return rdb.transactionHandler(ctx, "UnFollowPoster", func(ctx context.Context) error {
+		statement := `DELETE FROM follower WHERE email = ? AND follower = ?;`
+		result, err := rdb.execContext(ctx, statement, email, follower)
+		if err != nil {
+			logger.WithContext(ctx).Errorf("***** [POSTGRES:%s][FAIL] ***** Cannot execute DELETE operation:: %v", "UnFollowPoster", err)
+			return translateError(err)
+		}
+		if row, _ := result.RowsAffected(); row < 1 {
+			logger.WithContext(ctx).Errorf("***** [POSTGRES:%s][FAIL] ***** Cannot execute DELETE operation", "UnFollowPoster")
+			return fmt.Errorf("%w: row(s) affected: %d", ErrNotFound, row)
+		}
+
+		return rdb.updateFollowCounters(ctx, "UnFollowPoster", email, follower, -1)
+	})
+}
 
-	result, err := rdb.Poolx.Exec(statement, email, follower)
-	if err != nil {
-		log.Errorf("***** [POSTGRES:%s][FAIL] ***** Cannot execute DELETE operation:: %v", "UnFollowPoster", err)
-		return err
+func (rdb *RDB) updateFollowCounters(ctx context.Context, ops, email, follower string, delta int) error {
+	statement := `UPDATE poster SET followers_count = followers_count + ? WHERE email = ?;`
+	if _, err := rdb.execContext(ctx, statement, delta, email); err != nil {
+		logger.WithContext(ctx).Errorf("***** [POSTGRES:%s][FAIL] ***** Cannot execute UPDATE operation:: %v", ops, err)
+		return translateError(err)
 	}
-	if row, _ := result.RowsAffected(); row < 1 {
-		log.Errorf("***** [POSTGRES:%s][FAIL] ***** Cannot execute DELETE operation", "UnFollowPoster")
-		return errors.New(fmt.Sprintf("row(s) affected: %d", row))
+
+	statement = `UPDATE poster SET following_count = following_count + ? WHERE username = ?;`
+	if _, err := rdb.execContext(ctx, statement, delta, follower); err != nil {
+		logger.WithContext(ctx).Errorf("***** [POSTGRES:%s][FAIL] ***** Cannot execute UPDATE operation:: %v", ops, err)
+		return translateError(err)
 	}
 
 	return nil
@@ -0,0 +1,200 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	defaultReplicaHealthInterval = 5 * time.Second
+	replicaPingTimeout           = 2 * time.Second
+)
+
+// replica represents a read-only PostgreSQL replica
+type replica struct {
+	host    string
+	db      *sqlx.DB
+	healthy int32
+}
+
+// replicaSet routes queries to healthy replicas with round-robin
+type replicaSet struct {
+	replicas []*replica
+	next     uint32
+	stop     chan struct{}
+	once     sync.Once
+}
+
+// ReplicaStatus represents the health and pool statistics of a replica
+type ReplicaStatus struct {
+	Host    string      `json:"host"`
+	Healthy bool        `json:"healthy"`
+	Stats   sql.DBStats `json:"stats"`
+}
+
+type sessionKey struct{}
+
+// session records whether a request has written to primary, so its following reads stay on primary
+type session struct {
+	primary int32
+}
+
+/*
+WithSession binds a session to the context of a request. Once the request writes to primary, the following reads of
+the same request are routed to primary as well to read its own writes regardless of replication lag.
+*/
+func WithSession(ctx context.Context) context.Context {
+	return context.WithValue(ctx, sessionKey{}, &session{})
+}
+
+// UsePrimary forces the reads with the returned context to be routed to primary
+func UsePrimary(ctx context.Context) context.Context {
+	if s, ok := ctx.Value(sessionKey{}).(*session); ok {
+		atomic.StoreInt32(&s.primary, 1)
+		return ctx
+	}
+
+	return context.WithValue(ctx, sessionKey{}, &session{primary: 1})
+}
+
+func markWritten(ctx context.Context) {
+	if s, ok := ctx.Value(sessionKey{}).(*session); ok {
+		atomic.StoreInt32(&s.primary, 1)
+	}
+}
+
+func stickToPrimary(ctx context.Context) bool {
+	s, ok := ctx.Value(sessionKey{}).(*session)
+	return ok && atomic.LoadInt32(&s.primary) == 1
+}
+
+/*
+initReplicas opens connection pools to replicas without verifying them, so an unavailable replica never blocks the
+startup. Replicas only serve queries after passing health check.
+*/
+func initReplicas(c Config) *replicaSet {
+	rs := &replicaSet{stop: make(chan struct{})}
+	for _, host := range c.Replicas {
+		db, err := sqlx.Open("postgres", dataSourceName(c, host))
+		if err != nil {
+			logger.Errorf("***** [DATABASE][FAIL] ***** Failed to open connection to PostgreSQL replica::%s %v", host, err)
+			continue
+		}
+
+		configurePool(db, c.PoolConfig)
+		rs.replicas = append(rs.replicas, &replica{host: host, db: db})
+		logger.Infof("***** [DATABASE:PostgreSQL] ***** Register PostgreSQL replica::%s!", host)
+	}
+
+	if len(rs.replicas) > 0 {
+		rs.checkHealth()
+		go rs.watchHealth(c.ReplicaHealthInterval)
+	}
+	return rs
+}
+
+func (rs *replicaSet) watchHealth(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			rs.checkHealth()
+		case <-rs.stop:
+			return
+		}
+	}
+}
+
+// Close stops health check and closes connection pools of replicas, it's safe to be called more than once
+func (rs *replicaSet) Close() {
+	if rs == nil {
+		return
+	}
+
+	rs.once.Do(func() {
+		close(rs.stop)
+		for _, r := range rs.replicas {
+			if err := r.db.Close(); err != nil {
+				logger.Errorf("***** [DATABASE][FAIL] ***** Failed to close connection to PostgreSQL replica::%s %v", r.host, err)
+			}
+		}
+	})
+}
+
+func (rs *replicaSet) checkHealth() {
+	for _, r := range rs.replicas {
+		ctx, cancel := context.WithTimeout(context.Background(), replicaPingTimeout)
+		err := r.db.PingContext(ctx)
+		cancel()
+
+		healthy := int32(0)
+		if err == nil {
+			healthy = 1
+		}
+		if old := atomic.SwapInt32(&r.healthy, healthy); old != healthy {
+			if err != nil {
+				logger.Warnf("***** [DATABASE][REPLICA] ***** PostgreSQL replica::%s becomes unhealthy:: %v", r.host, err)
+			} else {
+				logger.Infof("***** [DATABASE][REPLICA] ***** PostgreSQL replica::%s becomes healthy", r.host)
+			}
+		}
+	}
+}
+
+// pick returns the next healthy replica or nil if none of replicas is healthy
+func (rs *replicaSet) pick() *replica {
+	if rs == nil {
+		return nil
+	}
+
+	n := uint32(len(rs.replicas))
+	for i := uint32(0); i < n; i++ {
+		r := rs.replicas[atomic.AddUint32(&rs.next, 1)%n]
+		if atomic.LoadInt32(&r.healthy) == 1 {
+			return r
+		}
+	}
+	return nil
+}
+
+/*
+reader returns the connection for read-only queries. Queries in a transaction or a session which has written stay on
+primary, otherwise they are routed to a healthy replica and fall back to primary if none is available.
+*/
+func (rdb *RDB) reader(ctx context.Context) sqlx.ExtContext {
+	if t, ok := ctx.Value(txKey{}).(*transaction); ok {
+		return t.tx
+	}
+	if stickToPrimary(ctx) {
+		return rdb.Poolx
+	}
+	if r := rdb.replicas.pick(); r != nil {
+		return r.db
+	}
+
+	return rdb.Poolx
+}
+
+// ReplicaStatus returns the health and pool statistics of all replicas
+func (rdb *RDB) ReplicaStatus() []ReplicaStatus {
+	status := []ReplicaStatus{}
+	if rdb.replicas == nil {
+		return status
+	}
+
+	for _, r := range rdb.replicas.replicas {
+		status = append(status, ReplicaStatus{
+			Host:    r.host,
+			Healthy: atomic.LoadInt32(&r.healthy) == 1,
+			Stats:   r.db.Stats(),
+		})
+	}
+	return status
+}
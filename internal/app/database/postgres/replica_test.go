@@ -0,0 +1,40 @@
+package postgres
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReplicaSetClose(t *testing.T) {
+	c := DefaultConfig()
+	c.Database, c.Username = "artemis", "artemis"
+	// Nothing listens on port 1, so replicas stay unhealthy without a PostgreSQL
+	c.Replicas = []string{"127.0.0.1:1", "127.0.0.2:1"}
+	c.ReplicaHealthInterval = 10 * time.Millisecond
+
+	rs := initReplicas(c)
+	if len(rs.replicas) != 2 {
+		t.Fatalf("replicas = %d, want 2", len(rs.replicas))
+	}
+	if r := rs.pick(); r != nil {
+		t.Errorf("pick of unreachable replicas = %s, want nil", r.host)
+	}
+
+	rs.Close()
+	select {
+	case <-rs.stop:
+	default:
+		t.Error("health check isn't stopped")
+	}
+	for _, r := range rs.replicas {
+		if err := r.db.PingContext(context.Background()); err == nil || !strings.Contains(err.Error(), "closed") {
+			t.Errorf("ping of closed replica %s = %v, want database is closed", r.host, err)
+		}
+	}
+
+	// Close is idempotent and nil replicaSet of RDB without replicas is a no-op
+	rs.Close()
+	(*replicaSet)(nil).Close()
+}
@@ -0,0 +1,44 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/linushung/artemis/internal/pkg/tracing"
+)
+
+/* Ref: https://opentelemetry.io/docs/specs/semconv/database/database-spans/ */
+// startSpan starts a client span of statement named after its operation, e.g. "SELECT"
+func startSpan(ctx context.Context, statement string) (context.Context, trace.Span) {
+	operation := operationOf(statement)
+	return tracing.Tracer().Start(ctx, operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBSystemNamePostgreSQL,
+			semconv.DBOperationName(operation),
+			semconv.DBQueryText(strings.Join(strings.Fields(statement), " ")),
+		),
+	)
+}
+
+// endSpan records err and ends span. Absence of rows isn't an error of database
+func endSpan(span trace.Span, err error) {
+	if err != nil && !errors.Is(err, sql.ErrNoRows) && !errors.Is(err, ErrNotFound) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+func operationOf(statement string) string {
+	if fields := strings.Fields(statement); len(fields) > 0 {
+		return strings.ToUpper(fields[0])
+	}
+	return "QUERY"
+}
@@ -0,0 +1,111 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/linushung/artemis/internal/pkg/tracing"
+)
+
+type txKey struct{}
+
+// transaction represents a DB transaction bound to a context and the number of savepoints created inside it
+type transaction struct {
+	tx         *sqlx.Tx
+	savepoints int
+}
+
+// conn returns the transaction bound to the context, otherwise the connection pool
+func (rdb *RDB) conn(ctx context.Context) sqlx.ExtContext {
+	if t, ok := ctx.Value(txKey{}).(*transaction); ok {
+		return t.tx
+	}
+
+	return rdb.Poolx
+}
+
+/*
+transactionHandler executes block in a DB transaction. Every repository method called with the context passed to block
+joins the transaction. The transaction is rolled back if block returns an error or panics, otherwise it is committed.
+A nested call creates a savepoint instead, so only the statements of the nested block are rolled back on failure.
+NOTE: A transaction holds a single connection, hence block must not use the context concurrently.
+*/
+func (rdb *RDB) transactionHandler(ctx context.Context, ops string, block func(ctx context.Context) error) (err error) {
+	if t, ok := ctx.Value(txKey{}).(*transaction); ok {
+		return rdb.savepointHandler(ctx, ops, t, block)
+	}
+
+	ctx, span := tracing.Tracer().Start(ctx, "TRANSACTION "+ops, trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.DBSystemNamePostgreSQL))
+	defer func() { endSpan(span, err) }()
+
+	markWritten(ctx)
+	tx, err := rdb.Poolx.BeginTxx(ctx, nil)
+	if err != nil {
+		logger.WithContext(ctx).Errorf("***** [POSTGRES:%s][FAIL] ***** Cannot execute BEGIN(Transaction) operation:: %v", ops, err)
+		return translateError(err)
+	}
+
+	defer recoverTransaction(ops, tx.Rollback)
+	if err := block(context.WithValue(ctx, txKey{}, &transaction{tx: tx})); err != nil {
+		if rbErr := tx.Rollback(); rbErr != nil {
+			logger.WithContext(ctx).Errorf("***** [POSTGRES:%s][FAIL] ***** Cannot execute ROLLBACK(Transaction) operation:: %v", ops, rbErr)
+		}
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		logger.WithContext(ctx).Errorf("***** [POSTGRES:%s][FAIL] ***** Cannot execute COMMIT(Transaction) operations:: %v", ops, err)
+		return translateError(err)
+	}
+
+	return nil
+}
+
+/* Ref: https://www.postgresql.org/docs/current/sql-savepoint.html */
+func (rdb *RDB) savepointHandler(ctx context.Context, ops string, t *transaction, block func(ctx context.Context) error) error {
+	t.savepoints++
+	savepoint := fmt.Sprintf("sp_%d", t.savepoints)
+
+	if _, err := t.tx.ExecContext(ctx, "SAVEPOINT "+savepoint); err != nil {
+		logger.WithContext(ctx).Errorf("***** [POSTGRES:%s][FAIL] ***** Cannot execute SAVEPOINT(Transaction) operation:: %v", ops, err)
+		return translateError(err)
+	}
+
+	rollback := func() error {
+		_, err := t.tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT "+savepoint)
+		return err
+	}
+
+	defer recoverTransaction(ops, rollback)
+	if err := block(ctx); err != nil {
+		if rbErr := rollback(); rbErr != nil {
+			logger.WithContext(ctx).Errorf("***** [POSTGRES:%s][FAIL] ***** Cannot execute ROLLBACK TO SAVEPOINT(Transaction) operation:: %v", ops, rbErr)
+		}
+		return err
+	}
+
+	if _, err := t.tx.ExecContext(ctx, "RELEASE SAVEPOINT "+savepoint); err != nil {
+		logger.WithContext(ctx).Errorf("***** [POSTGRES:%s][FAIL] ***** Cannot execute RELEASE SAVEPOINT(Transaction) operation:: %v", ops, err)
+		return translateError(err)
+	}
+
+	return nil
+}
+
+/* Ref:
+1. https://blog.golang.org/defer-panic-and-recover
+2. https://eli.thegreenplace.net/2018/on-the-uses-and-misuses-of-panics-in-go/
+*/
+// recoverTransaction rolls back the transaction (or savepoint) and re-panics, so the panic is not swallowed silently
+func recoverTransaction(ops string, rollback func() error) {
+	if p := recover(); p != nil {
+		logger.Errorf("***** [PANIC:%s] ***** Capture PANIC during DB Transaction:: %#v", ops, p)
+		rollback()
+		panic(p)
+	}
+}
@@ -0,0 +1,492 @@
+package circuitbreaker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/linushung/artemis/internal/pkg/logging"
+)
+
+// logger is the logger of subsystem circuitbreaker, whose level can be changed at runtime
+var logger = logging.Logger(logging.CircuitBreaker)
+
+/*
+Circuit Breaker:
+1. A breaker starts in Closed state. When the number of requests in the rolling window reaches RequestVolumeThreshold
+and the error percentage reaches ErrorPercentThreshold, the breaker trips to Open state and short-circuits requests.
+2. After SleepWindow elapses, the breaker turns to HalfOpen state and lets HalfOpenProbes requests through. The breaker
+closes if all probes succeed, otherwise it opens again for another SleepWindow.
+3. Requests cancelled by caller are neither counted as success nor failure.
+4. Bulkhead: at most MaxConcurrentRequests executions run at the same time. When MaxQueue is set, up to MaxQueue
+requests wait for at most QueueTimeout for a free slot before being rejected, otherwise they're rejected immediately.
+*/
+
+// State represents the state of a circuit breaker
+type State int32
+
+const (
+	Closed State = iota
+	HalfOpen
+	Open
+)
+
+func (s State) String() string {
+	switch s {
+	case Closed:
+		return "closed"
+	case HalfOpen:
+		return "half-open"
+	case Open:
+		return "open"
+	default:
+		return "unknown"
+	}
+}
+
+var (
+	// ErrOpen returns when an execution attempt is short-circuited by an open (or probing half-open) breaker
+	ErrOpen = errors.New("circuit open")
+	// ErrTimeout returns when the execution takes longer than Timeout
+	ErrTimeout = errors.New("timeout")
+	// ErrMaxConcurrency returns when too many executions of the same breaker run at the same time
+	ErrMaxConcurrency = errors.New("max concurrency")
+)
+
+const (
+	// DefaultTimeout is how long to wait for an execution to complete, in milliseconds
+	DefaultTimeout = 1000
+	// DefaultMaxConcurrentRequests is how many executions of the same breaker can run at the same time
+	DefaultMaxConcurrentRequests = 10
+	// DefaultRequestVolumeThreshold is the minimum number of requests in rolling window before a breaker can trip
+	DefaultRequestVolumeThreshold = 20
+	// DefaultSleepWindow is how long, in milliseconds, to wait after a breaker opens before probing for recovery
+	DefaultSleepWindow = 5000
+	// DefaultErrorPercentThreshold causes breakers to open once the error percentage of rolling window reaches it
+	DefaultErrorPercentThreshold = 50
+	// DefaultHalfOpenProbes is how many successful probes in half-open state are required to close a breaker
+	DefaultHalfOpenProbes = 1
+	// DefaultRollingWindow is the length of sliding window measuring error rate, in milliseconds
+	DefaultRollingWindow = 10000
+)
+
+// Config represents the configuration of a circuit breaker. Durations are in milliseconds
+type Config struct {
+	Timeout                int `mapstructure:"timeout" json:"timeout"`
+	MaxConcurrentRequests  int `mapstructure:"maxconcurrentrequests" json:"maxConcurrentRequests"`
+	RequestVolumeThreshold int `mapstructure:"requestvolumethreshold" json:"requestVolumeThreshold"`
+	SleepWindow            int `mapstructure:"sleepwindow" json:"sleepWindow"`
+	ErrorPercentThreshold  int `mapstructure:"errorpercentthreshold" json:"errorPercentThreshold"`
+	HalfOpenProbes         int `mapstructure:"halfopenprobes" json:"halfOpenProbes"`
+	RollingWindow          int `mapstructure:"rollingwindow" json:"rollingWindow"`
+	// MaxQueue is how many requests can wait for a free slot when MaxConcurrentRequests is reached, 0 disables queueing
+	MaxQueue int `mapstructure:"maxqueue" json:"maxQueue"`
+	// QueueTimeout is how long a queued request waits for a free slot, in milliseconds. Default to Timeout
+	QueueTimeout int `mapstructure:"queuetimeout" json:"queueTimeout"`
+}
+
+// WithDefaults returns a copy of configuration whose unset fields are replaced with default values
+func (c Config) WithDefaults() Config {
+	set := func(v *int, d int) {
+		if *v <= 0 {
+			*v = d
+		}
+	}
+
+	set(&c.Timeout, DefaultTimeout)
+	set(&c.MaxConcurrentRequests, DefaultMaxConcurrentRequests)
+	set(&c.RequestVolumeThreshold, DefaultRequestVolumeThreshold)
+	set(&c.SleepWindow, DefaultSleepWindow)
+	set(&c.ErrorPercentThreshold, DefaultErrorPercentThreshold)
+	set(&c.HalfOpenProbes, DefaultHalfOpenProbes)
+	set(&c.RollingWindow, DefaultRollingWindow)
+	if c.MaxQueue < 0 {
+		c.MaxQueue = 0
+	}
+	if c.MaxQueue > 0 {
+		set(&c.QueueTimeout, c.Timeout)
+	}
+	return c
+}
+
+// RunFunc is the function protected by a circuit breaker
+type RunFunc func(ctx context.Context) error
+
+// FallbackFunc is called with the error of RunFunc or the error of circuit breaker itself
+type FallbackFunc func(ctx context.Context, err error) error
+
+// CircuitBreaker defines the behaviour of a circuit breaker so that the implementation is pluggable
+type CircuitBreaker interface {
+	Name() string
+	State() State
+	// Concurrency returns the number of executions in flight and the maximum allowed
+	Concurrency() (inUse, max int)
+	// Queued returns the number of requests waiting for a free slot and the maximum allowed
+	Queued() (queued, max int)
+	Execute(ctx context.Context, run RunFunc, fallback FallbackFunc) error
+}
+
+// Controller defines the manual control of a circuit breaker at runtime, e.g. during incidents
+type Controller interface {
+	Config() Config
+	// Configure applies new configuration, statistics are reset if the rolling window changes
+	Configure(config Config)
+	// Force pins the breaker in Open or Closed state until Release or Reset is called
+	Force(state State) error
+	// Forced reports whether the breaker is pinned in a state
+	Forced() bool
+	Release()
+	// Reset clears statistics and override and closes the breaker
+	Reset()
+}
+
+// Breaker is the native implementation of CircuitBreaker which keeps its state per instance
+type Breaker struct {
+	name string
+
+	mu     sync.Mutex
+	config Config
+	// tickets limits the number of concurrent executions
+	tickets chan struct{}
+	// queued counts the requests waiting for a ticket
+	queued   int
+	state    State
+	forced   bool
+	openedAt time.Time
+	// probes and successes count the in-flight and successful probes in half-open state
+	probes    int
+	successes int
+	window    *rollingWindow
+	// now is the clock of breaker, it's replaced by tests
+	now func() time.Time
+}
+
+// New returns a Breaker in closed state
+func New(name string, config Config) *Breaker {
+	config = config.WithDefaults()
+	return &Breaker{
+		name:    name,
+		config:  config,
+		tickets: make(chan struct{}, config.MaxConcurrentRequests),
+		state:   Closed,
+		window:  newRollingWindow(time.Duration(config.RollingWindow) * time.Millisecond),
+		now:     time.Now,
+	}
+}
+
+// Name returns the name of breaker
+func (b *Breaker) Name() string {
+	return b.name
+}
+
+// Config returns the configuration of breaker
+func (b *Breaker) Config() Config {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.config
+}
+
+// Concurrency returns the number of executions in flight and the maximum allowed
+func (b *Breaker) Concurrency() (int, int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return len(b.tickets), cap(b.tickets)
+}
+
+// Queued returns the number of requests waiting for a free slot and the maximum allowed
+func (b *Breaker) Queued() (int, int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.queued, b.config.MaxQueue
+}
+
+// State returns the current state of breaker. An open breaker reports HalfOpen once its sleep window has elapsed
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refreshState(b.now())
+	return b.state
+}
+
+/*
+Configure applies new configuration to breaker. Executions in flight and queued requests keep the previous timeout and
+concurrency limit.
+*/
+func (b *Breaker) Configure(config Config) {
+	config = config.WithDefaults()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if config.MaxConcurrentRequests != b.config.MaxConcurrentRequests {
+		b.tickets = make(chan struct{}, config.MaxConcurrentRequests)
+	}
+	if config.RollingWindow != b.config.RollingWindow {
+		b.window = newRollingWindow(time.Duration(config.RollingWindow) * time.Millisecond)
+	}
+	b.config = config
+	logger.Warnf("***** [CIRCUITBREAKER:%s] ***** Apply configuration %+v", b.name, config)
+}
+
+// Force pins breaker in Open or Closed state, the breaker stops tripping or recovering by itself
+func (b *Breaker) Force(state State) error {
+	if state != Open && state != Closed {
+		return fmt.Errorf("circuit breaker can only be forced to %s or %s state", Open, Closed)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.setState(state, b.now())
+	b.forced = true
+	logger.Warnf("***** [CIRCUITBREAKER:%s] ***** Force state to %s", b.name, state)
+	return nil
+}
+
+// Forced reports whether breaker is pinned in a state
+func (b *Breaker) Forced() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.forced
+}
+
+// Release lets breaker change state by its statistics again
+func (b *Breaker) Release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.forced = false
+	logger.Warnf("***** [CIRCUITBREAKER:%s] ***** Release forced state %s", b.name, b.state)
+}
+
+// Reset clears statistics and override of breaker and closes it
+func (b *Breaker) Reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.forced = false
+	b.setState(Closed, b.now())
+	b.window.reset()
+	logger.Warnf("***** [CIRCUITBREAKER:%s] ***** Reset statistics", b.name)
+}
+
+/*
+Execute runs run with the protection of breaker. run receives a context cancelled after Timeout, and Execute returns
+ErrTimeout without waiting for run if run ignores the cancellation, but its slot of bulkhead is held until run
+returns. If the execution fails or is rejected, fallback is called with the error when it's not nil.
+*/
+func (b *Breaker) Execute(ctx context.Context, run RunFunc, fallback FallbackFunc) error {
+	err := b.execute(ctx, run)
+	if err != nil && fallback != nil {
+		return fallback(ctx, err)
+	}
+
+	return err
+}
+
+// admission represents a request allowed by breaker with the settings at the time it's allowed
+type admission struct {
+	probe        bool
+	tickets      chan struct{}
+	timeout      time.Duration
+	maxQueue     int
+	queueTimeout time.Duration
+}
+
+func (b *Breaker) execute(ctx context.Context, run RunFunc) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	a, err := b.allow()
+	if err != nil {
+		return err
+	}
+
+	if err = b.acquire(ctx, a); err != nil {
+		b.release(a.probe)
+		return err
+	}
+
+	runCtx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+
+	// The ticket is held until run returns, even after timeout, so runs ignoring cancellation still count against
+	// MaxConcurrentRequests instead of piling up unbounded goroutines
+	done := make(chan error, 1)
+	go func() {
+		defer func() { <-a.tickets }()
+		done <- run(runCtx)
+	}()
+
+	select {
+	case err = <-done:
+	case <-runCtx.Done():
+		err = ErrTimeout
+	}
+
+	// Cancellation of caller, e.g. the loser of hedged requests, isn't the fault of downstream but the attempt still
+	// counts toward request volume
+	if ctx.Err() != nil {
+		b.cancel(a.probe)
+		return ctx.Err()
+	}
+	if err != nil && runCtx.Err() == context.DeadlineExceeded {
+		err = ErrTimeout
+	}
+
+	b.report(a.probe, err == nil)
+	return err
+}
+
+// acquire takes a slot of bulkhead, waiting in queue for at most queueTimeout if queueing is enabled
+func (b *Breaker) acquire(ctx context.Context, a admission) error {
+	select {
+	case a.tickets <- struct{}{}:
+		return nil
+	default:
+	}
+
+	if !b.enqueue(a.maxQueue) {
+		return ErrMaxConcurrency
+	}
+	defer b.dequeue()
+
+	timer := time.NewTimer(a.queueTimeout)
+	defer timer.Stop()
+	select {
+	case a.tickets <- struct{}{}:
+		return nil
+	case <-timer.C:
+		return fmt.Errorf("%w: no free slot after waiting %s in queue", ErrMaxConcurrency, a.queueTimeout)
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (b *Breaker) enqueue(max int) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.queued >= max {
+		return false
+	}
+	b.queued++
+	return true
+}
+
+func (b *Breaker) dequeue() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.queued--
+}
+
+// allow checks whether a request can be made and reports whether the request is a probe of half-open state
+func (b *Breaker) allow() (admission, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	a := admission{
+		tickets:      b.tickets,
+		timeout:      time.Duration(b.config.Timeout) * time.Millisecond,
+		maxQueue:     b.config.MaxQueue,
+		queueTimeout: time.Duration(b.config.QueueTimeout) * time.Millisecond,
+	}
+	b.refreshState(b.now())
+	switch b.state {
+	case Open:
+		return a, ErrOpen
+	case HalfOpen:
+		if b.probes+b.successes >= b.config.HalfOpenProbes {
+			return a, ErrOpen
+		}
+		b.probes++
+		a.probe = true
+		return a, nil
+	default:
+		return a, nil
+	}
+}
+
+// release gives back the probe slot of a request which is not counted
+func (b *Breaker) release(probe bool) {
+	if !probe {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == HalfOpen && b.probes > 0 {
+		b.probes--
+	}
+}
+
+// cancel records a request cancelled by caller and gives back its probe slot, so another probe can be made
+func (b *Breaker) cancel(probe bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.window.cancel(b.now())
+	if probe && b.state == HalfOpen && b.probes > 0 {
+		b.probes--
+	}
+}
+
+func (b *Breaker) report(probe, success bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+	b.window.record(now, success)
+	if b.forced {
+		return
+	}
+
+	switch {
+	case probe && b.state == HalfOpen:
+		b.probes--
+		if !success {
+			b.setState(Open, now)
+			return
+		}
+		if b.successes++; b.successes >= b.config.HalfOpenProbes {
+			b.setState(Closed, now)
+		}
+	case b.state == Closed && !success:
+		total, failures := b.window.sum(now)
+		if total >= b.config.RequestVolumeThreshold && failures*100 >= b.config.ErrorPercentThreshold*total {
+			b.setState(Open, now)
+		}
+	}
+}
+
+// refreshState moves an open breaker to half-open state once its sleep window has elapsed
+func (b *Breaker) refreshState(now time.Time) {
+	if !b.forced && b.state == Open && now.Sub(b.openedAt) >= time.Duration(b.config.SleepWindow)*time.Millisecond {
+		b.setState(HalfOpen, now)
+	}
+}
+
+func (b *Breaker) setState(state State, now time.Time) {
+	if b.state == state {
+		return
+	}
+
+	logger.Warnf("***** [CIRCUITBREAKER:%s] ***** State changes from %s to %s", b.name, b.state, state)
+	b.state = state
+	b.probes, b.successes = 0, 0
+	switch state {
+	case Open:
+		b.openedAt = now
+	case Closed:
+		b.window.reset()
+	}
+}
@@ -0,0 +1,303 @@
+package circuitbreaker
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+var errDownstream = errors.New("downstream failure")
+
+// clock is a fake clock of breakers which only moves when advanced
+type clock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func newTestBreaker(config Config) (*Breaker, *clock) {
+	c := &clock{now: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+	b := New("test", config)
+	b.now = c.Now
+	return b, c
+}
+
+func succeed(context.Context) error { return nil }
+
+func fail(context.Context) error { return errDownstream }
+
+func execute(t *testing.T, b *Breaker, run RunFunc, times int) {
+	t.Helper()
+	for i := 0; i < times; i++ {
+		b.Execute(context.Background(), run, nil)
+	}
+}
+
+func TestBreakerTransitions(t *testing.T) {
+	b, c := newTestBreaker(Config{RequestVolumeThreshold: 4, ErrorPercentThreshold: 50, SleepWindow: 1000, HalfOpenProbes: 2})
+
+	execute(t, b, succeed, 2)
+	execute(t, b, fail, 1)
+	if s := b.State(); s != Closed {
+		t.Fatalf("state below request volume = %s, want %s", s, Closed)
+	}
+	execute(t, b, fail, 1)
+	if s := b.State(); s != Open {
+		t.Fatalf("state at 50%% errors of 4 requests = %s, want %s", s, Open)
+	}
+	if err := b.Execute(context.Background(), succeed, nil); !errors.Is(err, ErrOpen) {
+		t.Fatalf("Execute of open breaker = %v, want %v", err, ErrOpen)
+	}
+
+	c.Advance(999 * time.Millisecond)
+	if s := b.State(); s != Open {
+		t.Fatalf("state within sleep window = %s, want %s", s, Open)
+	}
+	c.Advance(time.Millisecond)
+	if s := b.State(); s != HalfOpen {
+		t.Fatalf("state after sleep window = %s, want %s", s, HalfOpen)
+	}
+
+	// A failed probe opens breaker for another sleep window
+	execute(t, b, fail, 1)
+	if s := b.State(); s != Open {
+		t.Fatalf("state after failed probe = %s, want %s", s, Open)
+	}
+
+	c.Advance(time.Second)
+	execute(t, b, succeed, 1)
+	if s := b.State(); s != HalfOpen {
+		t.Fatalf("state after 1 of 2 successful probes = %s, want %s", s, HalfOpen)
+	}
+	execute(t, b, succeed, 1)
+	if s := b.State(); s != Closed {
+		t.Fatalf("state after successful probes = %s, want %s", s, Closed)
+	}
+
+	// Statistics are reset once breaker closes
+	execute(t, b, fail, 3)
+	if s := b.State(); s != Closed {
+		t.Fatalf("state with failures before closing not reset = %s, want %s", s, Closed)
+	}
+}
+
+func TestBreakerLimitsHalfOpenProbes(t *testing.T) {
+	b, c := newTestBreaker(Config{RequestVolumeThreshold: 1, SleepWindow: 1000, HalfOpenProbes: 1})
+	execute(t, b, fail, 1)
+	c.Advance(time.Second)
+
+	started, release := make(chan struct{}), make(chan struct{})
+	go b.Execute(context.Background(), func(context.Context) error {
+		close(started)
+		<-release
+		return nil
+	}, nil)
+	<-started
+
+	if err := b.Execute(context.Background(), succeed, nil); !errors.Is(err, ErrOpen) {
+		t.Fatalf("Execute while probing = %v, want %v", err, ErrOpen)
+	}
+	close(release)
+}
+
+func TestBreakerSlidingWindow(t *testing.T) {
+	b, c := newTestBreaker(Config{RequestVolumeThreshold: 4, ErrorPercentThreshold: 50, RollingWindow: 1000})
+
+	execute(t, b, fail, 3)
+	// Failures slide out of window once it has elapsed
+	c.Advance(time.Second)
+	execute(t, b, fail, 1)
+	if s := b.State(); s != Closed {
+		t.Fatalf("state with expired failures = %s, want %s", s, Closed)
+	}
+
+	// Failures of the last buckets are still counted
+	c.Advance(500 * time.Millisecond)
+	execute(t, b, succeed, 1)
+	execute(t, b, fail, 2)
+	if s := b.State(); s != Open {
+		t.Fatalf("state with 3 failures of 4 requests in window = %s, want %s", s, Open)
+	}
+}
+
+func TestBreakerIgnoresCancellation(t *testing.T) {
+	b, _ := newTestBreaker(Config{RequestVolumeThreshold: 1})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	err := b.Execute(ctx, func(context.Context) error {
+		cancel()
+		return errDownstream
+	}, nil)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Execute cancelled by caller = %v, want %v", err, context.Canceled)
+	}
+	if s := b.State(); s != Closed {
+		t.Fatalf("state after cancellation = %s, want %s", s, Closed)
+	}
+}
+
+func TestBreakerCountsCancellation(t *testing.T) {
+	b, _ := newTestBreaker(Config{RequestVolumeThreshold: 4, ErrorPercentThreshold: 50})
+
+	// A cancelled attempt, e.g. the loser of hedged requests, adds to the volume without being a failure
+	ctx, cancel := context.WithCancel(context.Background())
+	b.Execute(ctx, func(context.Context) error {
+		cancel()
+		return errDownstream
+	}, nil)
+	execute(t, b, fail, 1)
+	execute(t, b, succeed, 1)
+	if s := b.State(); s != Closed {
+		t.Fatalf("state below request volume = %s, want %s", s, Closed)
+	}
+	execute(t, b, fail, 1)
+	if s := b.State(); s != Open {
+		t.Fatalf("state with 2 failures of 4 requests including cancelled = %s, want %s", s, Open)
+	}
+}
+
+func TestBreakerForce(t *testing.T) {
+	b, c := newTestBreaker(Config{RequestVolumeThreshold: 1, SleepWindow: 1000})
+
+	if err := b.Force(HalfOpen); err == nil {
+		t.Fatalf("Force(%s) = nil, want error", HalfOpen)
+	}
+
+	if err := b.Force(Open); err != nil {
+		t.Fatalf("Force(%s) = %v", Open, err)
+	}
+	c.Advance(time.Hour)
+	if err := b.Execute(context.Background(), succeed, nil); !errors.Is(err, ErrOpen) {
+		t.Fatalf("Execute of forced open breaker after sleep window = %v, want %v", err, ErrOpen)
+	}
+
+	if err := b.Force(Closed); err != nil {
+		t.Fatalf("Force(%s) = %v", Closed, err)
+	}
+	execute(t, b, fail, 5)
+	if s := b.State(); s != Closed || !b.Forced() {
+		t.Fatalf("state of forced closed breaker with failures = %s (forced %v), want forced %s", s, b.Forced(), Closed)
+	}
+
+	b.Release()
+	execute(t, b, fail, 1)
+	if s := b.State(); s != Open || b.Forced() {
+		t.Fatalf("state of released breaker with failures = %s (forced %v), want %s", s, b.Forced(), Open)
+	}
+
+	b.Reset()
+	if s := b.State(); s != Closed || b.Forced() {
+		t.Fatalf("state after reset = %s (forced %v), want %s", s, b.Forced(), Closed)
+	}
+}
+
+// block runs until release is closed, and signals started once it's running
+func block(started chan<- struct{}, release <-chan struct{}) RunFunc {
+	return func(context.Context) error {
+		started <- struct{}{}
+		<-release
+		return nil
+	}
+}
+
+func TestBreakerBulkheadRejectsWithoutQueue(t *testing.T) {
+	b, _ := newTestBreaker(Config{MaxConcurrentRequests: 1})
+
+	started, release := make(chan struct{}, 1), make(chan struct{})
+	go b.Execute(context.Background(), block(started, release), nil)
+	<-started
+
+	if err := b.Execute(context.Background(), succeed, nil); !errors.Is(err, ErrMaxConcurrency) {
+		t.Fatalf("Execute over max concurrency = %v, want %v", err, ErrMaxConcurrency)
+	}
+	close(release)
+}
+
+func TestBreakerBulkheadQueue(t *testing.T) {
+	b, _ := newTestBreaker(Config{Timeout: 5000, MaxConcurrentRequests: 1, MaxQueue: 1, QueueTimeout: 50})
+
+	started, release := make(chan struct{}, 1), make(chan struct{})
+	go b.Execute(context.Background(), block(started, release), nil)
+	<-started
+
+	// A queued request is rejected once it waits longer than QueueTimeout
+	if err := b.Execute(context.Background(), succeed, nil); !errors.Is(err, ErrMaxConcurrency) {
+		t.Fatalf("Execute after queue timeout = %v, want %v", err, ErrMaxConcurrency)
+	}
+
+	queued := make(chan error, 1)
+	go func() { queued <- b.Execute(context.Background(), succeed, nil) }()
+	waitFor(t, func() bool { n, _ := b.Queued(); return n == 1 })
+
+	// Requests over MaxQueue are rejected at once
+	if err := b.Execute(context.Background(), succeed, nil); !errors.Is(err, ErrMaxConcurrency) {
+		t.Fatalf("Execute over max queue = %v, want %v", err, ErrMaxConcurrency)
+	}
+
+	close(release)
+	if err := <-queued; err != nil {
+		t.Fatalf("Execute of queued request after a slot is freed = %v, want nil", err)
+	}
+}
+
+func TestBreakerTimeoutHoldsSlot(t *testing.T) {
+	b, _ := newTestBreaker(Config{Timeout: 20, MaxConcurrentRequests: 1})
+
+	release := make(chan struct{})
+	err := b.Execute(context.Background(), func(context.Context) error {
+		// run ignores cancellation of its context
+		<-release
+		return nil
+	}, nil)
+	if !errors.Is(err, ErrTimeout) {
+		t.Fatalf("Execute of slow run = %v, want %v", err, ErrTimeout)
+	}
+
+	if inUse, _ := b.Concurrency(); inUse != 1 {
+		t.Fatalf("slots in use while timed out run is still running = %d, want 1", inUse)
+	}
+	if err := b.Execute(context.Background(), succeed, nil); !errors.Is(err, ErrMaxConcurrency) {
+		t.Fatalf("Execute while timed out run holds the slot = %v, want %v", err, ErrMaxConcurrency)
+	}
+
+	close(release)
+	waitFor(t, func() bool { inUse, _ := b.Concurrency(); return inUse == 0 })
+}
+
+func TestBreakerFallback(t *testing.T) {
+	b, _ := newTestBreaker(Config{})
+
+	var got error
+	err := b.Execute(context.Background(), fail, func(_ context.Context, err error) error {
+		got = err
+		return nil
+	})
+	if err != nil || !errors.Is(got, errDownstream) {
+		t.Fatalf("Execute with fallback = %v (fallback got %v), want nil (%v)", err, got, errDownstream)
+	}
+}
+
+// waitFor polls cond until it's true or fails the test after a second
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition is not met within 1s")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,69 @@
+package circuitbreaker
+
+import "time"
+
+const rollingBuckets = 10
+
+type bucket struct {
+	// index is the sequence number of time slot the bucket currently counts for
+	index     int64
+	successes int
+	failures  int
+	// cancelled counts requests cancelled by caller, which add to volume but are neither successes nor failures
+	cancelled int
+}
+
+// rollingWindow counts outcomes in a sliding window made of fixed number of buckets
+type rollingWindow struct {
+	width   time.Duration
+	buckets [rollingBuckets]bucket
+}
+
+func newRollingWindow(length time.Duration) *rollingWindow {
+	width := length / rollingBuckets
+	if width <= 0 {
+		width = time.Millisecond
+	}
+
+	return &rollingWindow{width: width}
+}
+
+func (w *rollingWindow) bucketOf(now time.Time) *bucket {
+	index := now.UnixNano() / int64(w.width)
+	b := &w.buckets[index%rollingBuckets]
+	if b.index != index {
+		*b = bucket{index: index}
+	}
+
+	return b
+}
+
+func (w *rollingWindow) record(now time.Time, success bool) {
+	b := w.bucketOf(now)
+	if success {
+		b.successes++
+	} else {
+		b.failures++
+	}
+}
+
+func (w *rollingWindow) cancel(now time.Time) {
+	w.bucketOf(now).cancelled++
+}
+
+// sum returns the number of requests and failures in buckets within the window
+func (w *rollingWindow) sum(now time.Time) (total, failures int) {
+	index := now.UnixNano() / int64(w.width)
+	for _, b := range w.buckets {
+		if index-b.index < rollingBuckets {
+			total += b.successes + b.failures + b.cancelled
+			failures += b.failures
+		}
+	}
+
+	return total, failures
+}
+
+func (w *rollingWindow) reset() {
+	w.buckets = [rollingBuckets]bucket{}
+}
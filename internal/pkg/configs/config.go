@@ -11,21 +11,28 @@ import (
 
 var (
 	once sync.Once
+	// mu guards instance which is replaced as a whole when the configuration file changes, see WatchConfig
+	mu       sync.RWMutex
 	instance *viper.Viper
 )
 
+// newViper returns an instance reading default config, it's also used to read changes of the configuration file
+func newViper() *viper.Viper {
+	// default config
+	v := viper.New()
+	v.SetConfigType("yaml")
+	v.SetConfigName("default")
+	v.AddConfigPath("./configs")
+	// bind env variable and modify key mapping(e.g. envKey "SYSTEM_PORT" in k8s yaml mapping to configKey "system.port")
+	v.AutomaticEnv()
+	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	return v
+}
+
 /* Ref: http://marcio.io/2015/07/singleton-pattern-in-go/ */
 func InitConfig() {
 	once.Do(func() {
-		// default config
-		v := viper.New()
-		v.SetConfigType("yaml")
-		v.SetConfigName("default")
-		v.AddConfigPath("./configs")
-		// bind env variable and modify key mapping(e.g. envKey "SYSTEM_PORT" in k8s yaml mapping to configKey "system.port")
-		v.AutomaticEnv()
-		v.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
-
+		v := newViper()
 		if err := v.ReadInConfig(); err != nil {
 			log.Fatalf("***** [CONFIG][FAIL] ***** Failed to parse system configuration: \n%s", err)
 			os.Exit(1)
@@ -36,63 +43,9 @@ func InitConfig() {
 	})
 }
 
-// IsConfigSet checks if the key has been set in the configuration
-func IsConfigSet(key string) bool {
-	return instance.IsSet(key)
-}
-
-// GetConfigStr return string value of configuration
-func GetConfigStr(key string) string {
-	if key != "" {
-		return instance.GetString(key)
-	}
-	return ""
-}
-
-// GetConfigBool return boolean value of configuration
-func GetConfigBool(key string) bool {
-	if key != "" {
-		return instance.GetBool(key)
-	}
-	return false
-}
-
-// GetConfigInt return integer value of configuration
-func GetConfigInt(key string) int {
-	if key != "" {
-		return instance.GetInt(key)
-	}
-	return 0
-}
-
-// GetConfigSlice return slice of string value of configuration
-func GetConfigSlice(key string) []string {
-	if key != "" {
-		return instance.GetStringSlice(key)
-	}
-	return nil
-}
-
-// GetConfigMap return map value of configuration
-func GetConfigMap(key string) map[string]interface{} {
-	if key != "" {
-		return instance.GetStringMap(key)
-	}
-	return nil
-}
-
-// GetConfigMapString return map of string value of configuration
-func GetConfigMapString(key string) map[string]string {
-	if key != "" {
-		return instance.GetStringMapString(key)
-	}
-	return nil
-}
-
-// GetConfigUnmarshalKey take a single key and unmarshals it into a Struct
-func GetConfigUnmarshalKey(key string, s interface{}) error {
-	if key != "" {
-		return instance.UnmarshalKey(key, s)
-	}
-	return nil
+// current returns the configuration in effect
+func current() *viper.Viper {
+	mu.RLock()
+	defer mu.RUnlock()
+	return instance
 }
@@ -0,0 +1,79 @@
+package configs
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/mitchellh/mapstructure"
+)
+
+// FieldError is the error of a configuration key, e.g. "service.rest.port"
+type FieldError struct {
+	Key string
+	Err error
+}
+
+func (e FieldError) Error() string {
+	return e.Key + ": " + e.Err.Error()
+}
+
+func (e FieldError) Unwrap() error {
+	return e.Err
+}
+
+// Errors aggregates errors of configuration keys, so all of them are reported at once instead of the first one
+type Errors []FieldError
+
+// Add records err of key if it's not nil. Errors returned by Validate of a section are prefixed with key of the section
+func (e *Errors) Add(key string, err error) {
+	if err == nil {
+		return
+	}
+	var nested Errors
+	if errors.As(err, &nested) {
+		for _, f := range nested {
+			*e = append(*e, FieldError{strings.Trim(key+"."+f.Key, "."), f.Err})
+		}
+		return
+	}
+	*e = append(*e, FieldError{key, err})
+}
+
+// Addf records an error of key formatted by fmt.Errorf
+func (e *Errors) Addf(key, format string, args ...interface{}) {
+	e.Add(key, fmt.Errorf(format, args...))
+}
+
+// Err returns e, or nil if no error is recorded
+func (e Errors) Err() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
+
+// Error lists errors ordered by key
+func (e Errors) Error() string {
+	sorted := append(Errors{}, e...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Key < sorted[j].Key })
+
+	lines := make([]string, 0, len(e)+1)
+	lines = append(lines, fmt.Sprintf("%d invalid configuration keys:", len(e)))
+	for _, f := range sorted {
+		lines = append(lines, "  * "+f.Error())
+	}
+	return strings.Join(lines, "\n")
+}
+
+/*
+Unmarshal decodes the whole configuration into s strictly, keys without a field in s (e.g. typos) and values which
+can't be converted to type of their fields (e.g. port ":8080" of an int) fail decoding. Fields of keys which are not
+set keep their values, so s can be filled with default values beforehand.
+*/
+func (c Config) Unmarshal(s interface{}) error {
+	return c.v.Unmarshal(s, func(dc *mapstructure.DecoderConfig) {
+		dc.ErrorUnused = true
+	})
+}
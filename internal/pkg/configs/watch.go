@@ -0,0 +1,173 @@
+package configs
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+/*
+Hot reload:
+1. WatchConfig watches the configuration file with a shadow viper instance, so the configuration in effect is never
+modified in place.
+2. On change, the file is read into a candidate configuration. Validators of prefixes whose values changed check the
+candidate, and the candidate is discarded if any of them fails, i.e. the old configuration is kept.
+3. Otherwise subscribers of changed prefixes apply the candidate in order of subscription. If one of them fails, e.g.
+a sink can't be opened, the subscribers which already applied it are notified again to revert to the old
+configuration, and the candidate is discarded.
+4. The candidate replaces the configuration in effect only after all subscribers applied it.
+*/
+var (
+	watchOnce   sync.Once
+	reloadMu    sync.Mutex
+	subscribers []subscription
+	validators  []validation
+)
+
+// Config is a read-only view of a configuration passed to validators and subscribers
+type Config struct {
+	v *viper.Viper
+}
+
+// Get returns value of key
+func (c Config) Get(key string) interface{} {
+	return c.v.Get(key)
+}
+
+// IsSet checks if the key has been set in the configuration
+func (c Config) IsSet(key string) bool {
+	return c.v.IsSet(key)
+}
+
+// GetString returns string value of key
+func (c Config) GetString(key string) string {
+	return c.v.GetString(key)
+}
+
+// UnmarshalKey takes a single key and unmarshals it into a Struct
+func (c Config) UnmarshalKey(key string, s interface{}) error {
+	return c.v.UnmarshalKey(key, s)
+}
+
+// Current returns the configuration in effect
+func Current() Config {
+	return Config{current()}
+}
+
+// Validator checks a candidate configuration, returning an error keeps the configuration in effect
+type Validator func(candidate Config) error
+
+// Subscriber applies the new configuration after keys under its prefix changed, returning an error rejects the change
+type Subscriber func(old, new Config) error
+
+type validation struct {
+	prefix   string
+	validate Validator
+}
+
+type subscription struct {
+	prefix string
+	notify Subscriber
+}
+
+// RegisterValidator registers validator of keys under prefix, e.g. "circuitbreaker.registers"
+func RegisterValidator(prefix string, validator Validator) {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+	validators = append(validators, validation{strings.ToLower(prefix), validator})
+}
+
+// Subscribe registers subscriber of keys under prefix, an empty prefix subscribes to any change
+func Subscribe(prefix string, subscriber Subscriber) {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+	subscribers = append(subscribers, subscription{strings.ToLower(prefix), subscriber})
+}
+
+// changed reports whether value of prefix differs between old and new configuration
+func changed(old, new *viper.Viper, prefix string) bool {
+	if prefix == "" {
+		return !reflect.DeepEqual(old.AllSettings(), new.AllSettings())
+	}
+	return !reflect.DeepEqual(old.Get(prefix), new.Get(prefix))
+}
+
+/* Ref: https://github.com/spf13/viper#watching-and-re-reading-config-files */
+// WatchConfig starts watching the configuration file and applies its changes, see Hot reload above
+func WatchConfig() {
+	watchOnce.Do(func() {
+		shadow := newViper()
+		if err := shadow.ReadInConfig(); err != nil {
+			log.Errorf("***** [CONFIG][FAIL] ***** Failed to watch system configuration:: %v", err)
+			return
+		}
+
+		shadow.OnConfigChange(func(e fsnotify.Event) {
+			if err := Reload(); err != nil {
+				log.Errorf("***** [CONFIG][FAIL] ***** Keep the current configuration, reject change of %s:: %v", e.Name, err)
+			}
+		})
+		shadow.WatchConfig()
+		log.Infof("***** [CONFIG] ***** Watch system configuration %s ......", shadow.ConfigFileUsed())
+	})
+}
+
+// Reload reads the configuration file, validates and applies it. The configuration in effect is kept on any error
+func Reload() error {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+
+	candidate := newViper()
+	if err := candidate.ReadInConfig(); err != nil {
+		return err
+	}
+	old := current()
+	if !changed(old, candidate, "") {
+		return nil
+	}
+
+	for _, v := range validators {
+		if !changed(old, candidate, v.prefix) {
+			continue
+		}
+		if err := v.validate(Config{candidate}); err != nil {
+			if v.prefix == "" {
+				return err
+			}
+			return fmt.Errorf("invalid %s: %w", v.prefix, err)
+		}
+	}
+
+	var applied []subscription
+	for _, s := range subscribers {
+		if !changed(old, candidate, s.prefix) {
+			continue
+		}
+		if err := s.notify(Config{old}, Config{candidate}); err != nil {
+			revert(applied, old, candidate)
+			return fmt.Errorf("cannot apply %s: %w", s.prefix, err)
+		}
+		applied = append(applied, s)
+	}
+
+	mu.Lock()
+	instance = candidate
+	mu.Unlock()
+	log.Warnf("***** [CONFIG] ***** Apply change of system configuration ......")
+	return nil
+}
+
+// revert notifies subscribers which applied candidate to restore old configuration, in reverse order
+func revert(applied []subscription, old, candidate *viper.Viper) {
+	for n := len(applied) - 1; n >= 0; n-- {
+		s := applied[n]
+		if err := s.notify(Config{candidate}, Config{old}); err != nil {
+			log.Errorf("***** [CONFIG][FAIL] ***** Failed to revert change of %s:: %v", s.prefix, err)
+		}
+	}
+}
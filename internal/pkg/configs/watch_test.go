@@ -0,0 +1,90 @@
+package configs
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeConfig writes configs/default.yaml under dir, which newViper reads relative to the working directory
+func writeConfig(t *testing.T, dir, content string) {
+	t.Helper()
+	if err := ioutil.WriteFile(filepath.Join(dir, "configs", "default.yaml"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "configs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.Mkdir(filepath.Join(dir, "configs"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	wd, _ := os.Getwd()
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	writeConfig(t, dir, "a: 1\nb: ok\nc: 1\n")
+	InitConfig()
+
+	var applied []string
+	RegisterValidator("c", func(candidate Config) error {
+		if candidate.GetString("c") == "invalid" {
+			return errors.New("c is invalid")
+		}
+		return nil
+	})
+	Subscribe("a", func(old, new Config) error {
+		applied = append(applied, old.GetString("a")+"->"+new.GetString("a"))
+		return nil
+	})
+	Subscribe("b", func(_, new Config) error {
+		if new.GetString("b") == "unavailable" {
+			return errors.New("b is unavailable")
+		}
+		applied = append(applied, "b="+new.GetString("b"))
+		return nil
+	})
+
+	tests := []struct {
+		name    string
+		content string
+		valid   bool
+		applied []string
+		a       string
+	}{
+		{"unchanged", "a: 1\nb: ok\nc: 1\n", true, nil, "1"},
+		{"invalid", "a: 2\nb: ok\nc: invalid\n", false, nil, "1"},
+		{"vetoed by subscriber", "a: 2\nb: unavailable\nc: 1\n", false, []string{"1->2", "2->1"}, "1"},
+		{"applied", "a: 2\nb: ready\nc: 1\n", true, []string{"1->2", "b=ready"}, "2"},
+	}
+	for _, tt := range tests {
+		applied = nil
+		writeConfig(t, dir, tt.content)
+
+		err := Reload()
+		if (err == nil) != tt.valid {
+			t.Errorf("%s: Reload = %v, want valid %v", tt.name, err, tt.valid)
+		}
+		if len(applied) != len(tt.applied) {
+			t.Errorf("%s: subscribers applied %v, want %v", tt.name, applied, tt.applied)
+		} else {
+			for i := range applied {
+				if applied[i] != tt.applied[i] {
+					t.Errorf("%s: subscribers applied %v, want %v", tt.name, applied, tt.applied)
+					break
+				}
+			}
+		}
+		if a := Current().GetString("a"); a != tt.a {
+			t.Errorf("%s: a in effect = %s, want %s", tt.name, a, tt.a)
+		}
+	}
+}
@@ -0,0 +1,283 @@
+/*
+Package faults injects latency, error status codes, aborted connections and DB errors for chaos testing. Nothing is
+injected unless "faultinjection.enabled" is set, in which case rules are loaded from "faultinjection.rules" and can be
+replaced at runtime by admin API.
+*/
+package faults
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/linushung/artemis/internal/pkg/configs"
+)
+
+// Targets of rules
+const (
+	// Inbound matches Pattern against the route pattern and path of requests to Artemis
+	Inbound = "inbound"
+	// Outbound matches Pattern against host and path of requests to downstream, e.g. "localhost:8000/status/*"
+	Outbound = "outbound"
+	// DB matches Pattern case-insensitively as a substring of SQL statements, e.g. "INSERT INTO article"
+	DB = "db"
+)
+
+// Errors of DB faults, the storage layer translates them into its domain errors
+const (
+	ErrorTimeout   = "timeout"
+	ErrorNotFound  = "notfound"
+	ErrorConflict  = "conflict"
+	ErrorForbidden = "forbidden"
+	ErrorInternal  = "internal"
+)
+
+var (
+	// ErrDisabled returns when rules are changed while fault injection is disabled by configuration
+	ErrDisabled = errors.New("fault injection is disabled")
+	// ErrAborted returns to outbound requests whose connection is aborted by fault injection
+	ErrAborted = errors.New("connection aborted by fault injection")
+)
+
+/*
+Rule represents a fault injected into Percentage of requests of Target matching Method and Pattern. Pattern of
+inbound and outbound rules is a glob where "*" matches within a path segment and "**" matches across segments, and
+an empty Pattern matches everything. Delay is in milliseconds and is injected before Status, Abort or Error.
+*/
+type Rule struct {
+	Name   string `mapstructure:"name" json:"name"`
+	Target string `mapstructure:"target" json:"target"`
+	// Method is HTTP method of inbound or outbound requests, or "read" or "write" of DB statements
+	Method     string  `mapstructure:"method" json:"method,omitempty"`
+	Pattern    string  `mapstructure:"pattern" json:"pattern,omitempty"`
+	Percentage float64 `mapstructure:"percentage" json:"percentage"`
+	Delay      int     `mapstructure:"delay" json:"delay,omitempty"`
+	// Status is the error status code responded to inbound or outbound requests
+	Status int `mapstructure:"status" json:"status,omitempty"`
+	// Abort closes the connection of inbound requests or fails outbound requests with ErrAborted
+	Abort bool `mapstructure:"abort" json:"abort,omitempty"`
+	// Error is the error of DB statements, one of "timeout", "notfound", "conflict", "forbidden" and "internal"
+	Error string `mapstructure:"error" json:"error,omitempty"`
+
+	glob *regexp.Regexp
+}
+
+// compileGlob converts glob pattern into an anchored regular expression
+func compileGlob(pattern string) (*regexp.Regexp, error) {
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; {
+		case c == '*' && i+1 < len(pattern) && pattern[i+1] == '*':
+			b.WriteString(".*")
+			i++
+		case c == '*':
+			b.WriteString("[^/]*")
+		case c == '?':
+			b.WriteString("[^/]")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.Compile(b.String())
+}
+
+// compile validates rule and compiles its pattern
+func (r *Rule) compile() error {
+	if r.Percentage < 0 || r.Percentage > 100 {
+		return fmt.Errorf("percentage of rule %s must be between 0 and 100: %v", r.Name, r.Percentage)
+	}
+	if r.Delay < 0 {
+		return fmt.Errorf("delay of rule %s must not be negative: %d", r.Name, r.Delay)
+	}
+
+	switch r.Target {
+	case Inbound, Outbound:
+		if r.Status != 0 && (r.Status < 400 || r.Status > 599) {
+			return fmt.Errorf("status of rule %s must be an error status code: %d", r.Name, r.Status)
+		}
+		if r.Error != "" {
+			return fmt.Errorf("error of rule %s only applies to target %s", r.Name, DB)
+		}
+	case DB:
+		switch r.Error {
+		case "", ErrorTimeout, ErrorNotFound, ErrorConflict, ErrorForbidden, ErrorInternal:
+		default:
+			return fmt.Errorf("unknown error of rule %s: %s", r.Name, r.Error)
+		}
+		if r.Status != 0 || r.Abort {
+			return fmt.Errorf("status and abort of rule %s don't apply to target %s", r.Name, DB)
+		}
+	default:
+		return fmt.Errorf("unknown target of rule %s: %s", r.Name, r.Target)
+	}
+
+	if r.Target != DB && r.Pattern != "" {
+		glob, err := compileGlob(r.Pattern)
+		if err != nil {
+			return fmt.Errorf("invalid pattern of rule %s: %v", r.Name, err)
+		}
+		r.glob = glob
+	}
+	return nil
+}
+
+func (r Rule) matches(target, method string, subjects ...string) bool {
+	if r.Target != target || (r.Method != "" && !strings.EqualFold(r.Method, method)) {
+		return false
+	}
+	if r.Pattern == "" {
+		return true
+	}
+
+	for _, s := range subjects {
+		if target == DB {
+			if strings.Contains(strings.ToLower(s), strings.ToLower(r.Pattern)) {
+				return true
+			}
+			continue
+		}
+		if r.glob != nil && r.glob.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
+
+// Wait sleeps for Delay of rule, or until ctx is done
+func (r Rule) Wait(ctx context.Context) error {
+	if r.Delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(time.Duration(r.Delay) * time.Millisecond)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Injector holds the rules of fault injection
+type Injector struct {
+	enabled bool
+
+	mu    sync.RWMutex
+	rules []Rule
+}
+
+// Config represents "faultinjection"
+type Config struct {
+	Enabled bool   `mapstructure:"enabled"`
+	Rules   []Rule `mapstructure:"rules"`
+}
+
+// Validate checks rules even if fault injection is disabled, so they can be enabled safely
+func (c Config) Validate() error {
+	var errs configs.Errors
+	for n := range c.Rules {
+		r := c.Rules[n]
+		errs.Add(fmt.Sprintf("rules[%d]", n), r.compile())
+	}
+	return errs.Err()
+}
+
+// injector is disabled until Init is called with "faultinjection.enabled" set
+var injector = &Injector{}
+
+// Init loads the rules of fault injection from c
+func Init(c Config) {
+	if !c.Enabled {
+		return
+	}
+
+	i := &Injector{enabled: true}
+	if err := i.SetRules(c.Rules); err != nil {
+		log.Fatalf("***** [INIT:FAULTS][FAIL] ***** Invalid rules of fault injection:: %v ......", err)
+	}
+	injector = i
+	log.Warnf("***** [INIT:FAULTS] ***** Fault injection is enabled with %d rules ......", len(c.Rules))
+}
+
+// Get returns the injector of Artemis
+func Get() *Injector {
+	return injector
+}
+
+// Enabled reports whether fault injection is enabled by configuration
+func (i *Injector) Enabled() bool {
+	return i.enabled
+}
+
+// Rules returns the current rules
+func (i *Injector) Rules() []Rule {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	return append([]Rule{}, i.rules...)
+}
+
+// SetRules replaces all rules, an empty rules stops injecting faults
+func (i *Injector) SetRules(rules []Rule) error {
+	if !i.enabled {
+		return ErrDisabled
+	}
+	compiled := append([]Rule{}, rules...)
+	for n := range compiled {
+		if err := compiled[n].compile(); err != nil {
+			return err
+		}
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.rules = compiled
+	return nil
+}
+
+/*
+Match returns the first rule matching request of target whose dice roll falls within its percentage. subjects are
+matched against Pattern of rules, e.g. both route pattern and path of a request.
+*/
+func (i *Injector) Match(target, method string, subjects ...string) (Rule, bool) {
+	if !i.enabled {
+		return Rule{}, false
+	}
+
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	for _, r := range i.rules {
+		if r.matches(target, method, subjects...) && rand.Float64()*100 < r.Percentage {
+			log.Debugf("***** [FAULTS:%s] ***** Inject fault of rule %s into [METHOD:%s] %v", target, r.Name, method, subjects)
+			return r, true
+		}
+	}
+	return Rule{}, false
+}
+
+/* Ref: https://pkg.go.dev/net/http#Hijacker */
+// Abort closes the connection of inbound request without responding
+func Abort(w http.ResponseWriter) {
+	if hj, ok := w.(http.Hijacker); ok {
+		if conn, _, err := hj.Hijack(); err == nil {
+			conn.Close()
+			return
+		}
+	}
+
+	// HTTP/2 can't be hijacked, net/http resets the stream instead
+	panic(http.ErrAbortHandler)
+}
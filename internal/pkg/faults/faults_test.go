@@ -0,0 +1,152 @@
+package faults
+
+import (
+	"math"
+	"net/http"
+	"testing"
+)
+
+func TestRuleMatchesGlob(t *testing.T) {
+	tests := []struct {
+		pattern string
+		subject string
+		matches bool
+	}{
+		{"", "/api/articles/hello", true},
+		{"/api/articles/*", "/api/articles/hello", true},
+		{"/api/articles/*", "/api/articles/hello/comments", false},
+		{"/api/**", "/api/articles/hello/comments", true},
+		{"/api/**/comments", "/api/articles/hello/comments", true},
+		{"/api/**/comments", "/api/articles/hello", false},
+		{"/api/articles/?", "/api/articles/a", true},
+		{"/api/articles/?", "/api/articles/ab", false},
+		{"/api/profiles/{username}", "/api/profiles/{username}", true},
+		{"/api/profiles/{username}", "/api/profiles/jake", false},
+		{"/api/users", "/api/users/login", false},
+		{"localhost:8000/status/*", "localhost:8000/status/500", true},
+		{"*.local/get", "partner.local/get", true},
+	}
+	for _, tt := range tests {
+		r := Rule{Name: "glob", Target: Inbound, Pattern: tt.pattern}
+		if err := r.compile(); err != nil {
+			t.Fatalf("compile %q:: %v", tt.pattern, err)
+		}
+		if matches := r.matches(Inbound, http.MethodGet, tt.subject); matches != tt.matches {
+			t.Errorf("pattern %q matches %q = %v, want %v", tt.pattern, tt.subject, matches, tt.matches)
+		}
+	}
+}
+
+func TestRuleMatches(t *testing.T) {
+	tests := []struct {
+		name     string
+		rule     Rule
+		target   string
+		method   string
+		subjects []string
+		matches  bool
+	}{
+		{"any subject", Rule{Target: Inbound, Pattern: "/api/articles/{slug}"}, Inbound, http.MethodGet, []string{"/api/articles/hello", "/api/articles/{slug}"}, true},
+		{"method", Rule{Target: Inbound, Method: "post"}, Inbound, http.MethodPost, []string{"/api/users"}, true},
+		{"other method", Rule{Target: Inbound, Method: http.MethodPost}, Inbound, http.MethodGet, []string{"/api/users"}, false},
+		{"other target", Rule{Target: Outbound}, Inbound, http.MethodGet, []string{"/api/users"}, false},
+		{"db substring", Rule{Target: DB, Pattern: "insert into article"}, DB, "write", []string{"INSERT INTO article (slug) VALUES ($1)"}, true},
+		{"db other statement", Rule{Target: DB, Pattern: "insert into article"}, DB, "read", []string{"SELECT * FROM article"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := tt.rule
+			if err := r.compile(); err != nil {
+				t.Fatalf("compile:: %v", err)
+			}
+			if matches := r.matches(tt.target, tt.method, tt.subjects...); matches != tt.matches {
+				t.Errorf("matches = %v, want %v", matches, tt.matches)
+			}
+		})
+	}
+}
+
+func TestRuleCompile(t *testing.T) {
+	tests := []struct {
+		name  string
+		rule  Rule
+		valid bool
+	}{
+		{"inbound", Rule{Target: Inbound, Percentage: 100, Status: http.StatusServiceUnavailable}, true},
+		{"db", Rule{Target: DB, Percentage: 50, Error: ErrorTimeout}, true},
+		{"percentage over 100", Rule{Target: Inbound, Percentage: 101}, false},
+		{"negative percentage", Rule{Target: Inbound, Percentage: -1}, false},
+		{"negative delay", Rule{Target: Inbound, Delay: -1}, false},
+		{"status not error", Rule{Target: Outbound, Status: http.StatusOK}, false},
+		{"error of inbound", Rule{Target: Inbound, Error: ErrorTimeout}, false},
+		{"unknown error", Rule{Target: DB, Error: "deadlock"}, false},
+		{"abort of db", Rule{Target: DB, Abort: true}, false},
+		{"unknown target", Rule{Target: "cache"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.rule.compile(); (err == nil) != tt.valid {
+				t.Errorf("compile = %v, want valid %v", err, tt.valid)
+			}
+		})
+	}
+}
+
+func TestInjectorMatchPercentage(t *testing.T) {
+	const requests = 10000
+	tests := []struct {
+		percentage float64
+		// tolerance is the allowed deviation of the ratio of injected requests
+		tolerance float64
+	}{
+		{0, 0},
+		{100, 0},
+		{25, 0.03},
+		{50, 0.03},
+	}
+	for _, tt := range tests {
+		i := &Injector{enabled: true}
+		if err := i.SetRules([]Rule{{Name: "half", Target: Inbound, Percentage: tt.percentage}}); err != nil {
+			t.Fatalf("SetRules:: %v", err)
+		}
+
+		injected := 0
+		for n := 0; n < requests; n++ {
+			if _, ok := i.Match(Inbound, http.MethodGet, "/api/users"); ok {
+				injected++
+			}
+		}
+		if ratio := float64(injected) / requests; math.Abs(ratio-tt.percentage/100) > tt.tolerance {
+			t.Errorf("ratio of requests injected by %v%% = %v", tt.percentage, ratio)
+		}
+	}
+}
+
+func TestInjectorFirstMatchingRule(t *testing.T) {
+	i := &Injector{enabled: true}
+	rules := []Rule{
+		{Name: "never", Target: Inbound, Percentage: 0},
+		{Name: "articles", Target: Inbound, Pattern: "/api/articles/**", Percentage: 100},
+		{Name: "all", Target: Inbound, Percentage: 100},
+	}
+	if err := i.SetRules(rules); err != nil {
+		t.Fatalf("SetRules:: %v", err)
+	}
+
+	if r, ok := i.Match(Inbound, http.MethodGet, "/api/articles/hello"); !ok || r.Name != "articles" {
+		t.Errorf("rule of /api/articles/hello = %s (%v), want articles", r.Name, ok)
+	}
+	if r, ok := i.Match(Inbound, http.MethodGet, "/api/users"); !ok || r.Name != "all" {
+		t.Errorf("rule of /api/users = %s (%v), want all", r.Name, ok)
+	}
+}
+
+func TestInjectorDisabled(t *testing.T) {
+	i := &Injector{}
+	if err := i.SetRules([]Rule{{Target: Inbound, Percentage: 100}}); err != ErrDisabled {
+		t.Errorf("SetRules of disabled injector = %v, want %v", err, ErrDisabled)
+	}
+	if _, ok := i.Match(Inbound, http.MethodGet, "/api/users"); ok {
+		t.Error("disabled injector matches a rule")
+	}
+}
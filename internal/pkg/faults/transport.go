@@ -0,0 +1,52 @@
+package faults
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+)
+
+// Transport is a http.RoundTripper injecting faults of target Outbound into requests made by Base
+type Transport struct {
+	Base http.RoundTripper
+}
+
+// WrapTransport returns Transport over base, http.DefaultTransport is used if base is nil
+func WrapTransport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &Transport{Base: base}
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	r, ok := Get().Match(Outbound, req.Method, req.URL.Host+req.URL.Path)
+	if !ok {
+		return t.Base.RoundTrip(req)
+	}
+
+	if err := r.Wait(req.Context()); err != nil {
+		return nil, err
+	}
+	switch {
+	case r.Abort:
+		return nil, fmt.Errorf("%w: rule %s", ErrAborted, r.Name)
+	case r.Status != 0:
+		body := fmt.Sprintf("fault injected by rule %s", r.Name)
+		return &http.Response{
+			Status:        fmt.Sprintf("%d %s", r.Status, http.StatusText(r.Status)),
+			StatusCode:    r.Status,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        http.Header{"Content-Type": {"text/plain; charset=utf-8"}},
+			Body:          ioutil.NopCloser(bytes.NewBufferString(body)),
+			ContentLength: int64(len(body)),
+			Request:       req,
+		}, nil
+	default:
+		return t.Base.RoundTrip(req)
+	}
+}
@@ -0,0 +1,171 @@
+/*
+Package health aggregates checkers of dependencies into liveness and readiness of Artemis. Liveness only reports
+that the process is serving, while readiness runs every registered checker with a timeout and caches the report
+briefly, so frequent probes of load balancers and orchestrators don't hammer the dependencies.
+*/
+package health
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Status of checks and reports
+const (
+	StatusUp   = "up"
+	StatusDown = "down"
+	// StatusShuttingDown reports readiness during graceful shutdown, the checkers are not run anymore
+	StatusShuttingDown = "shutting_down"
+)
+
+const (
+	defaultTimeout = 2 * time.Second
+	defaultTTL     = time.Second
+)
+
+// Checker checks a dependency and returns an error if it's not usable
+type Checker interface {
+	Check(ctx context.Context) error
+}
+
+// CheckerFunc adapts an ordinary function into Checker
+type CheckerFunc func(ctx context.Context) error
+
+// Check calls f(ctx)
+func (f CheckerFunc) Check(ctx context.Context) error {
+	return f(ctx)
+}
+
+// Check represents the result of a single checker
+type Check struct {
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+	Duration string `json:"duration"`
+}
+
+// Report represents the aggregated result of all checkers
+type Report struct {
+	Status    string           `json:"status"`
+	CheckedAt time.Time        `json:"checkedAt"`
+	Checks    map[string]Check `json:"checks"`
+}
+
+// Up reports whether every check is up
+func (r Report) Up() bool {
+	return r.Status == StatusUp
+}
+
+// Health runs registered checkers for readiness
+type Health struct {
+	// Timeout bounds each checker, and TTL is how long a report is reused before checkers run again
+	Timeout time.Duration
+	TTL     time.Duration
+
+	mu           sync.Mutex
+	checkers     map[string]Checker
+	report       Report
+	shuttingDown atomic.Bool
+}
+
+// New returns Health with timeout of each checker and TTL of reports, zero values are replaced with default values
+func New(timeout, ttl time.Duration) *Health {
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	if ttl <= 0 {
+		ttl = defaultTTL
+	}
+
+	return &Health{Timeout: timeout, TTL: ttl, checkers: map[string]Checker{}}
+}
+
+// Register adds checker of name to readiness, a checker registered with the same name is replaced
+func (h *Health) Register(name string, c Checker) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.checkers[name] = c
+	h.report = Report{}
+}
+
+// Shutdown flips readiness to not-ready permanently, so traffic is drained before the server stops
+func (h *Health) Shutdown() {
+	if !h.shuttingDown.Swap(true) {
+		log.Warnf("***** [HEALTH] ***** Shutting down, report not ready from now on")
+	}
+}
+
+// Ready returns the cached report if it's younger than TTL, otherwise runs all checkers concurrently
+func (h *Health) Ready(ctx context.Context) Report {
+	if h.shuttingDown.Load() {
+		return Report{Status: StatusShuttingDown, CheckedAt: time.Now(), Checks: map[string]Check{}}
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if !h.report.CheckedAt.IsZero() && time.Since(h.report.CheckedAt) < h.TTL {
+		return h.report
+	}
+
+	// Checks outlive the probe which triggers them, since their report is shared by later probes
+	h.report = h.run(context.WithoutCancel(ctx))
+	return h.report
+}
+
+func (h *Health) run(ctx context.Context) Report {
+	names := make([]string, 0, len(h.checkers))
+	for name := range h.checkers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	checks := make([]Check, len(names))
+	var wg sync.WaitGroup
+	for i, name := range names {
+		wg.Add(1)
+		go func(i int, c Checker) {
+			defer wg.Done()
+			checks[i] = h.check(ctx, c)
+		}(i, h.checkers[name])
+	}
+	wg.Wait()
+
+	r := Report{Status: StatusUp, CheckedAt: time.Now(), Checks: make(map[string]Check, len(names))}
+	for i, name := range names {
+		r.Checks[name] = checks[i]
+		if checks[i].Status != StatusUp {
+			r.Status = StatusDown
+			log.Warnf("***** [HEALTH][FAIL] ***** Check %s is down:: %s", name, checks[i].Error)
+		}
+	}
+	return r
+}
+
+func (h *Health) check(ctx context.Context, c Checker) Check {
+	ctx, cancel := context.WithTimeout(ctx, h.Timeout)
+	defer cancel()
+
+	start := time.Now()
+	errTube := make(chan error, 1)
+	// A checker ignoring ctx can't block readiness longer than Timeout
+	go func() { errTube <- c.Check(ctx) }()
+
+	var err error
+	select {
+	case err = <-errTube:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	check := Check{Status: StatusUp, Duration: time.Since(start).String()}
+	if err != nil {
+		check.Status = StatusDown
+		check.Error = err.Error()
+	}
+	return check
+}
@@ -0,0 +1,121 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var (
+	up   = CheckerFunc(func(context.Context) error { return nil })
+	down = CheckerFunc(func(context.Context) error { return errors.New("connection refused") })
+	// hang ignores ctx, so only Timeout of Health bounds it
+	hang = CheckerFunc(func(context.Context) error {
+		time.Sleep(time.Second)
+		return nil
+	})
+	// slow returns when ctx is done
+	slow = CheckerFunc(func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+)
+
+func TestHealthReady(t *testing.T) {
+	const timeout = 50 * time.Millisecond
+	tests := []struct {
+		name     string
+		checkers map[string]Checker
+		status   string
+		down     []string
+	}{
+		{"no checker", nil, StatusUp, nil},
+		{"all up", map[string]Checker{"postgres": up, "httpbin": up}, StatusUp, nil},
+		{"dependency down", map[string]Checker{"postgres": down, "httpbin": up}, StatusDown, []string{"postgres"}},
+		{"checker times out", map[string]Checker{"postgres": slow, "httpbin": up}, StatusDown, []string{"postgres"}},
+		{"checker ignores timeout", map[string]Checker{"postgres": up, "httpbin": hang}, StatusDown, []string{"httpbin"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := New(timeout, time.Minute)
+			for name, c := range tt.checkers {
+				h.Register(name, c)
+			}
+
+			start := time.Now()
+			r := h.Ready(context.Background())
+			if elapsed := time.Since(start); elapsed > timeout+100*time.Millisecond {
+				t.Errorf("Ready took %s, want within timeout %s", elapsed, timeout)
+			}
+			if r.Status != tt.status || r.Up() != (tt.status == StatusUp) {
+				t.Errorf("status = %s, want %s", r.Status, tt.status)
+			}
+			if len(r.Checks) != len(tt.checkers) {
+				t.Errorf("checks = %v, want %d", r.Checks, len(tt.checkers))
+			}
+			for _, name := range tt.down {
+				if c := r.Checks[name]; c.Status != StatusDown || c.Error == "" {
+					t.Errorf("check %s = %+v, want down with error", name, c)
+				}
+			}
+		})
+	}
+}
+
+func TestHealthReadyCachesReport(t *testing.T) {
+	var calls int32
+	h := New(time.Second, 50*time.Millisecond)
+	h.Register("postgres", CheckerFunc(func(context.Context) error {
+		atomic.AddInt32(&calls, 1)
+		return nil
+	}))
+
+	h.Ready(context.Background())
+	h.Ready(context.Background())
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Errorf("checks within TTL = %d, want 1", n)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	h.Ready(context.Background())
+	if n := atomic.LoadInt32(&calls); n != 2 {
+		t.Errorf("checks after TTL = %d, want 2", n)
+	}
+
+	// A registered checker invalidates the cached report
+	h.Register("httpbin", down)
+	if r := h.Ready(context.Background()); r.Status != StatusDown {
+		t.Errorf("status after registering a checker down = %s, want %s", r.Status, StatusDown)
+	}
+}
+
+func TestHealthShutdown(t *testing.T) {
+	var calls int32
+	h := New(time.Second, time.Minute)
+	h.Register("postgres", CheckerFunc(func(context.Context) error {
+		atomic.AddInt32(&calls, 1)
+		return nil
+	}))
+	if r := h.Ready(context.Background()); !r.Up() {
+		t.Fatalf("status before shutdown = %s, want %s", r.Status, StatusUp)
+	}
+
+	h.Shutdown()
+	h.Shutdown()
+	r := h.Ready(context.Background())
+	if r.Status != StatusShuttingDown || r.Up() {
+		t.Errorf("status after shutdown = %s, want %s", r.Status, StatusShuttingDown)
+	}
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Errorf("checks after shutdown = %d, want 1 before shutdown only", n)
+	}
+}
+
+func TestNewDefaults(t *testing.T) {
+	h := New(0, -1)
+	if h.Timeout != defaultTimeout || h.TTL != defaultTTL {
+		t.Errorf("New(0, -1) = %s, %s, want %s, %s", h.Timeout, h.TTL, defaultTimeout, defaultTTL)
+	}
+}
@@ -0,0 +1,318 @@
+package httpcache
+
+import (
+	"container/list"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+Cache is an in-memory HTTP cache following the semantics of RFC 9111 of a shared cache, since a response stored for
+one caller is served to all callers of the same register:
+1. Responses are stored unless either request or response has "Cache-Control: no-store" or "Vary: *". Responses of
+requests with "Authorization" and responses with "Cache-Control: private" are only stored if response explicitly
+allows a shared cache with "public", "s-maxage" or "must-revalidate".
+2. A stored response is fresh for "s-maxage" of response, otherwise "max-age", otherwise until "Expires", otherwise
+10% of the time since "Last-Modified" (heuristic freshness). "no-cache" makes it stale immediately.
+3. Stale responses with "ETag" or "Last-Modified" are revalidated with a conditional request, see Transport.
+4. Responses are stored per variant of the request headers listed in "Vary", the least recently used variants of a
+URL are evicted once they exceed MaxVariants.
+5. The least recently used URLs are evicted once the number of URLs exceeds the size of cache.
+
+Ref: https://www.rfc-editor.org/rfc/rfc9111.html
+*/
+type Cache struct {
+	mu         sync.Mutex
+	maxEntries int
+	ll         *list.List
+	items      map[string]*list.Element
+}
+
+// MaxVariants is the number of variants stored per URL, so a header listed in Vary with arbitrary values (e.g.
+// User-Agent) can't grow the cache without bound
+const MaxVariants = 8
+
+// bucket holds the stored variants of a URL, ordered from the most recently used
+type bucket struct {
+	key      string
+	variants []*Entry
+}
+
+// Entry represents a stored response
+type Entry struct {
+	StatusCode int
+	Status     string
+	Header     http.Header
+	Body       []byte
+	// varied holds the values of request headers listed in Vary of response
+	varied http.Header
+	// storedAt is when the response was received or last revalidated
+	storedAt time.Time
+}
+
+// New returns a Cache holding responses of at most maxEntries URLs
+func New(maxEntries int) *Cache {
+	return &Cache{maxEntries: maxEntries, ll: list.New(), items: map[string]*list.Element{}}
+}
+
+// Len returns the number of URLs stored
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.ll.Len()
+}
+
+// Get returns the stored response of key whose variant matches the headers of request, fresh or not
+func (c *Cache) Get(key string, reqHeader http.Header) (*Entry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	c.ll.MoveToFront(el)
+	b := el.Value.(*bucket)
+	for i, e := range b.variants {
+		if e.matches(reqHeader) {
+			b.touch(i)
+			return e, true
+		}
+	}
+	return nil, false
+}
+
+// Put stores response of key, replacing the stored variant which matches the headers of request
+func (c *Cache) Put(key string, reqHeader http.Header, e *Entry) {
+	e.varied = http.Header{}
+	for _, name := range varyOf(e.Header) {
+		if v, ok := reqHeader[name]; ok {
+			e.varied[name] = v
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.items[key]; ok {
+		c.ll.MoveToFront(el)
+		b := el.Value.(*bucket)
+		for i, v := range b.variants {
+			if v.matches(reqHeader) {
+				b.variants[i] = e
+				b.touch(i)
+				return
+			}
+		}
+		b.variants = append([]*Entry{e}, b.variants...)
+		if len(b.variants) > MaxVariants {
+			b.variants = b.variants[:MaxVariants]
+		}
+		return
+	}
+
+	c.items[key] = c.ll.PushFront(&bucket{key: key, variants: []*Entry{e}})
+	for c.maxEntries > 0 && c.ll.Len() > c.maxEntries {
+		oldest := c.ll.Back()
+		c.ll.Remove(oldest)
+		delete(c.items, oldest.Value.(*bucket).key)
+	}
+}
+
+// Delete invalidates all stored variants of key
+func (c *Cache) Delete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.items[key]; ok {
+		c.ll.Remove(el)
+		delete(c.items, key)
+	}
+}
+
+// touch moves the i-th variant to the front as the most recently used
+func (b *bucket) touch(i int) {
+	e := b.variants[i]
+	copy(b.variants[1:i+1], b.variants[:i])
+	b.variants[0] = e
+}
+
+/* Ref: https://www.rfc-editor.org/rfc/rfc9111.html#section-4.1 */
+func (e *Entry) matches(reqHeader http.Header) bool {
+	for _, name := range varyOf(e.Header) {
+		if strings.Join(reqHeader[name], ",") != strings.Join(e.varied[name], ",") {
+			return false
+		}
+	}
+	return true
+}
+
+/* Ref: https://www.rfc-editor.org/rfc/rfc9111.html#section-4.2.3 */
+// Age returns how long the response has been stored, including the age reported by downstream
+func (e *Entry) Age(now time.Time) time.Duration {
+	age := now.Sub(e.storedAt)
+	if seconds, err := strconv.Atoi(e.Header.Get("Age")); err == nil && seconds > 0 {
+		age += time.Duration(seconds) * time.Second
+	}
+	if age < 0 {
+		return 0
+	}
+	return age
+}
+
+/* Ref: https://www.rfc-editor.org/rfc/rfc9111.html#section-4.2.1 */
+// lifetime returns how long the response is fresh after it's generated
+func (e *Entry) lifetime() time.Duration {
+	cc := parseCacheControl(e.Header)
+	if cc.has("no-cache") {
+		return 0
+	}
+	if sMaxAge, ok := cc.seconds("s-maxage"); ok {
+		return sMaxAge
+	}
+	if maxAge, ok := cc.seconds("max-age"); ok {
+		return maxAge
+	}
+
+	date, err := http.ParseTime(e.Header.Get("Date"))
+	if err != nil {
+		date = e.storedAt
+	}
+	if expires := e.Header.Get("Expires"); expires != "" {
+		// An invalid Expires, e.g. "0", means already expired
+		t, err := http.ParseTime(expires)
+		if err != nil {
+			return 0
+		}
+		return t.Sub(date)
+	}
+	if lastModified, err := http.ParseTime(e.Header.Get("Last-Modified")); err == nil && date.After(lastModified) {
+		return date.Sub(lastModified) / 10
+	}
+	return 0
+}
+
+// Fresh reports whether the response can be served without revalidation
+func (e *Entry) Fresh(now time.Time) bool {
+	return e.Age(now) < e.lifetime()
+}
+
+/* Ref: https://www.rfc-editor.org/rfc/rfc9111.html#section-4.2.4 */
+/*
+ServableStale reports whether the response can be served when downstream is unavailable, i.e. it's fresh or stale
+for at most maxStale (0 means no limit) and response doesn't forbid serving stale with "must-revalidate".
+*/
+func (e *Entry) ServableStale(now time.Time, maxStale time.Duration) bool {
+	if e.Fresh(now) {
+		return true
+	}
+	if parseCacheControl(e.Header).has("must-revalidate") {
+		return false
+	}
+
+	return maxStale <= 0 || e.Age(now)-e.lifetime() <= maxStale
+}
+
+// validators returns the headers of conditional request revalidating the response
+func (e *Entry) validators() http.Header {
+	h := http.Header{}
+	if etag := e.Header.Get("ETag"); etag != "" {
+		h.Set("If-None-Match", etag)
+	}
+	if lastModified := e.Header.Get("Last-Modified"); lastModified != "" {
+		h.Set("If-Modified-Since", lastModified)
+	}
+	return h
+}
+
+/* Ref: https://www.rfc-editor.org/rfc/rfc9111.html#section-4.3.4 */
+// refresh returns a copy of the response updated with the headers of 304 response
+func (e *Entry) refresh(header http.Header, now time.Time) *Entry {
+	updated := &Entry{StatusCode: e.StatusCode, Status: e.Status, Header: e.Header.Clone(), Body: e.Body, storedAt: now}
+	for name, values := range header {
+		updated.Header[name] = values
+	}
+	updated.Header.Del("Age")
+	return updated
+}
+
+/* Ref: https://www.rfc-editor.org/rfc/rfc9110.html#section-15.1 */
+var heuristicallyCacheable = map[int]bool{
+	http.StatusOK: true, http.StatusNonAuthoritativeInfo: true, http.StatusNoContent: true,
+	http.StatusMultipleChoices: true, http.StatusMovedPermanently: true, http.StatusPermanentRedirect: true,
+	http.StatusNotFound: true, http.StatusMethodNotAllowed: true, http.StatusGone: true,
+	http.StatusRequestURITooLong: true, http.StatusNotImplemented: true,
+}
+
+/* Ref: https://www.rfc-editor.org/rfc/rfc9111.html#section-3 */
+// storable reports whether the response of GET request can be stored in a shared cache
+func storable(reqHeader http.Header, status int, resHeader http.Header) bool {
+	if !heuristicallyCacheable[status] {
+		return false
+	}
+	cc := parseCacheControl(resHeader)
+	if parseCacheControl(reqHeader).has("no-store") || cc.has("no-store") {
+		return false
+	}
+	/* Ref: https://www.rfc-editor.org/rfc/rfc9111.html#section-3.5 */
+	shared := cc.has("public") || cc.has("s-maxage") || cc.has("must-revalidate")
+	if (reqHeader.Get("Authorization") != "" || cc.has("private")) && !shared {
+		return false
+	}
+	for _, name := range varyOf(resHeader) {
+		if name == "*" {
+			return false
+		}
+	}
+	return true
+}
+
+// varyOf returns the canonical names of request headers listed in Vary
+func varyOf(header http.Header) []string {
+	var names []string
+	for _, v := range header.Values("Vary") {
+		for _, name := range strings.Split(v, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, http.CanonicalHeaderKey(name))
+			}
+		}
+	}
+	return names
+}
+
+// cacheControl represents the directives of Cache-Control header
+type cacheControl map[string]string
+
+func parseCacheControl(header http.Header) cacheControl {
+	cc := cacheControl{}
+	for _, v := range header.Values("Cache-Control") {
+		for _, directive := range strings.Split(v, ",") {
+			name, value, _ := strings.Cut(strings.TrimSpace(directive), "=")
+			if name != "" {
+				cc[strings.ToLower(name)] = strings.Trim(value, `"`)
+			}
+		}
+	}
+	return cc
+}
+
+func (cc cacheControl) has(directive string) bool {
+	_, ok := cc[directive]
+	return ok
+}
+
+func (cc cacheControl) seconds(directive string) (time.Duration, bool) {
+	v, ok := cc[directive]
+	if !ok {
+		return 0, false
+	}
+	seconds, err := strconv.Atoi(v)
+	if err != nil || seconds < 0 {
+		return 0, false
+	}
+	return time.Duration(seconds) * time.Second, true
+}
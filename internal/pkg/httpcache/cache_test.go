@@ -0,0 +1,182 @@
+package httpcache
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+var epoch = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func header(kv ...string) http.Header {
+	h := http.Header{}
+	for i := 0; i+1 < len(kv); i += 2 {
+		h.Add(kv[i], kv[i+1])
+	}
+	return h
+}
+
+func TestEntryFresh(t *testing.T) {
+	date := epoch.Format(http.TimeFormat)
+	tests := []struct {
+		name   string
+		header http.Header
+		age    time.Duration
+		fresh  bool
+	}{
+		{"within max-age", header("Cache-Control", "max-age=60"), 59 * time.Second, true},
+		{"after max-age", header("Cache-Control", "max-age=60"), 60 * time.Second, false},
+		{"s-maxage over max-age", header("Cache-Control", "max-age=60, s-maxage=10"), 30 * time.Second, false},
+		{"max-age over expires", header("Cache-Control", "max-age=60", "Date", date, "Expires", epoch.Add(time.Hour).Format(http.TimeFormat)), 2 * time.Minute, false},
+		{"age of downstream", header("Cache-Control", "max-age=60", "Age", "50"), 20 * time.Second, false},
+		{"no-cache", header("Cache-Control", "no-cache, max-age=60"), 0, false},
+		{"within expires", header("Date", date, "Expires", epoch.Add(time.Minute).Format(http.TimeFormat)), 59 * time.Second, true},
+		{"after expires", header("Date", date, "Expires", epoch.Add(time.Minute).Format(http.TimeFormat)), time.Minute, false},
+		{"invalid expires", header("Date", date, "Expires", "0"), 0, false},
+		{"heuristic", header("Date", date, "Last-Modified", epoch.Add(-10*time.Hour).Format(http.TimeFormat)), 59 * time.Minute, true},
+		{"after heuristic", header("Date", date, "Last-Modified", epoch.Add(-10*time.Hour).Format(http.TimeFormat)), time.Hour, false},
+		{"without freshness", header(), 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := &Entry{StatusCode: http.StatusOK, Header: tt.header, storedAt: epoch}
+			if fresh := e.Fresh(epoch.Add(tt.age)); fresh != tt.fresh {
+				t.Errorf("Fresh after %s = %v, want %v", tt.age, fresh, tt.fresh)
+			}
+		})
+	}
+}
+
+func TestEntryServableStale(t *testing.T) {
+	tests := []struct {
+		name     string
+		header   http.Header
+		maxStale time.Duration
+		servable bool
+	}{
+		{"without limit", header("Cache-Control", "max-age=60"), 0, true},
+		{"within max stale", header("Cache-Control", "max-age=60"), 2 * time.Minute, true},
+		{"over max stale", header("Cache-Control", "max-age=60"), 30 * time.Second, false},
+		{"must-revalidate", header("Cache-Control", "max-age=60, must-revalidate"), 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := &Entry{StatusCode: http.StatusOK, Header: tt.header, storedAt: epoch}
+			if servable := e.ServableStale(epoch.Add(2*time.Minute), tt.maxStale); servable != tt.servable {
+				t.Errorf("ServableStale = %v, want %v", servable, tt.servable)
+			}
+		})
+	}
+}
+
+func TestStorable(t *testing.T) {
+	tests := []struct {
+		name     string
+		req      http.Header
+		status   int
+		res      http.Header
+		storable bool
+	}{
+		{"cacheable", header(), http.StatusOK, header("Cache-Control", "max-age=60"), true},
+		{"not heuristically cacheable", header(), http.StatusInternalServerError, header("Cache-Control", "max-age=60"), false},
+		{"no-store of request", header("Cache-Control", "no-store"), http.StatusOK, header(), false},
+		{"no-store of response", header(), http.StatusOK, header("Cache-Control", "no-store"), false},
+		{"vary all", header(), http.StatusOK, header("Vary", "Accept, *"), false},
+		{"private", header(), http.StatusOK, header("Cache-Control", "private, max-age=60"), false},
+		{"authorization", header("Authorization", "Bearer token"), http.StatusOK, header("Cache-Control", "max-age=60"), false},
+		{"authorization and public", header("Authorization", "Bearer token"), http.StatusOK, header("Cache-Control", "public, max-age=60"), true},
+		{"authorization and s-maxage", header("Authorization", "Bearer token"), http.StatusOK, header("Cache-Control", "s-maxage=60"), true},
+		{"authorization and must-revalidate", header("Authorization", "Bearer token"), http.StatusOK, header("Cache-Control", "must-revalidate"), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if storable := storable(tt.req, tt.status, tt.res); storable != tt.storable {
+				t.Errorf("storable = %v, want %v", storable, tt.storable)
+			}
+		})
+	}
+}
+
+func TestCacheVary(t *testing.T) {
+	c := New(10)
+	put := func(lang string) {
+		c.Put("/greeting", header("Accept-Language", lang), &Entry{
+			StatusCode: http.StatusOK,
+			Header:     header("Vary", "accept-language"),
+			Body:       []byte(lang),
+		})
+	}
+	get := func(lang string) string {
+		e, ok := c.Get("/greeting", header("Accept-Language", lang))
+		if !ok {
+			return ""
+		}
+		return string(e.Body)
+	}
+
+	put("en")
+	put("fr")
+	if got := get("en"); got != "en" {
+		t.Errorf("variant of en = %q, want %q", got, "en")
+	}
+	if got := get("fr"); got != "fr" {
+		t.Errorf("variant of fr = %q, want %q", got, "fr")
+	}
+	if got := get("de"); got != "" {
+		t.Errorf("variant of de = %q, want none", got)
+	}
+	if _, ok := c.Get("/greeting", header()); ok {
+		t.Error("variant without Accept-Language is found, want none")
+	}
+	if c.Len() != 1 {
+		t.Errorf("Len = %d, want 1 URL", c.Len())
+	}
+}
+
+func TestCacheMaxVariants(t *testing.T) {
+	c := New(10)
+	put := func(i int) {
+		c.Put("/agent", header("User-Agent", fmt.Sprint(i)), &Entry{StatusCode: http.StatusOK, Header: header("Vary", "User-Agent")})
+	}
+	found := func(i int) bool {
+		_, ok := c.Get("/agent", header("User-Agent", fmt.Sprint(i)))
+		return ok
+	}
+
+	for i := 0; i < MaxVariants; i++ {
+		put(i)
+	}
+	// Variant 0 becomes the most recently used, so variant 1 is evicted
+	found(0)
+	put(MaxVariants)
+
+	if !found(0) {
+		t.Error("recently used variant 0 is evicted")
+	}
+	if found(1) {
+		t.Error("least recently used variant 1 is not evicted")
+	}
+	for i := 2; i <= MaxVariants; i++ {
+		if !found(i) {
+			t.Errorf("variant %d is evicted", i)
+		}
+	}
+}
+
+func TestCacheEvictsLeastRecentlyUsedURL(t *testing.T) {
+	c := New(2)
+	c.Put("/a", header(), &Entry{})
+	c.Put("/b", header(), &Entry{})
+	c.Get("/a", header())
+	c.Put("/c", header(), &Entry{})
+
+	if _, ok := c.Get("/b", header()); ok {
+		t.Error("least recently used /b is not evicted")
+	}
+	for _, key := range []string{"/a", "/c"} {
+		if _, ok := c.Get(key, header()); !ok {
+			t.Errorf("%s is evicted", key)
+		}
+	}
+}
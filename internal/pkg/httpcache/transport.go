@@ -0,0 +1,130 @@
+package httpcache
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+/*
+Transport is a http.RoundTripper serving GET requests from Cache. Fresh responses are served without calling Base,
+stale responses are revalidated with If-None-Match and If-Modified-Since, and a 304 response refreshes the stored
+response. Successful requests of unsafe methods invalidate the stored responses of the same URL.
+*/
+type Transport struct {
+	Cache *Cache
+	// Base makes the actual requests, http.DefaultTransport is used if it's nil
+	Base http.RoundTripper
+}
+
+// Key returns the key of request in Cache
+func Key(req *http.Request) string {
+	return req.URL.String()
+}
+
+func (t *Transport) base() http.RoundTripper {
+	if t.Base == nil {
+		return http.DefaultTransport
+	}
+	return t.Base
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	key := Key(req)
+	switch req.Method {
+	case http.MethodGet:
+	case http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return t.base().RoundTrip(req)
+	default:
+		/* Ref: https://www.rfc-editor.org/rfc/rfc9111.html#section-4.4 */
+		res, err := t.base().RoundTrip(req)
+		if err == nil && res.StatusCode < http.StatusBadRequest {
+			t.Cache.Delete(key)
+		}
+		return res, err
+	}
+	if parseCacheControl(req.Header).has("no-store") || req.Header.Get("Range") != "" {
+		return t.base().RoundTrip(req)
+	}
+
+	now := time.Now()
+	e, ok := t.Cache.Get(key, req.Header)
+	if ok && e.Fresh(now) && !parseCacheControl(req.Header).has("no-cache") {
+		return e.response(req, now), nil
+	}
+
+	outReq := req
+	revalidating := false
+	if ok {
+		if validators := e.validators(); len(validators) > 0 {
+			outReq = req.Clone(req.Context())
+			for name, values := range validators {
+				outReq.Header[name] = values
+			}
+			revalidating = true
+		}
+	}
+
+	res, err := t.base().RoundTrip(outReq)
+	if err != nil {
+		return nil, err
+	}
+	now = time.Now()
+	if revalidating && res.StatusCode == http.StatusNotModified {
+		io.Copy(ioutil.Discard, res.Body)
+		res.Body.Close()
+		e = e.refresh(res.Header, now)
+		t.Cache.Put(key, req.Header, e)
+		return e.response(req, now), nil
+	}
+	if !storable(req.Header, res.StatusCode, res.Header) {
+		return res, nil
+	}
+
+	body, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	t.Cache.Put(key, req.Header, &Entry{
+		StatusCode: res.StatusCode,
+		Status:     res.Status,
+		Header:     res.Header.Clone(),
+		Body:       body,
+		storedAt:   now,
+	})
+	res.Body = ioutil.NopCloser(bytes.NewReader(body))
+	return res, nil
+}
+
+// response builds *http.Response of request from the stored response with Age header
+func (e *Entry) response(req *http.Request, now time.Time) *http.Response {
+	header := e.Header.Clone()
+	header.Set("Age", strconv.Itoa(int(e.Age(now).Seconds())))
+	return &http.Response{
+		Status:        e.Status,
+		StatusCode:    e.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader(e.Body)),
+		ContentLength: int64(len(e.Body)),
+		Request:       req,
+	}
+}
+
+// Stale returns the stored response of GET request which is servable when downstream is unavailable
+func (c *Cache) Stale(req *http.Request, maxStale time.Duration) (*http.Response, bool) {
+	now := time.Now()
+	e, ok := c.Get(Key(req), req.Header)
+	if !ok || !e.ServableStale(now, maxStale) {
+		return nil, false
+	}
+
+	return e.response(req, now), true
+}
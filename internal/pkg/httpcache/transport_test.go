@@ -0,0 +1,140 @@
+package httpcache
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+// get makes GET request of url through rt and returns the status code and body of response
+func get(t *testing.T, rt http.RoundTripper, url string, kv ...string) (int, string) {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodGet, url, nil)
+	req.Header = header(kv...)
+	res, err := rt.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("GET %s:: %v", url, err)
+	}
+	defer res.Body.Close()
+	body, _ := ioutil.ReadAll(res.Body)
+	return res.StatusCode, string(body)
+}
+
+func TestTransportServesFreshResponse(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Write([]byte("fresh"))
+	}))
+	defer server.Close()
+	rt := &Transport{Cache: New(10)}
+
+	for i := 0; i < 3; i++ {
+		if status, body := get(t, rt, server.URL); status != http.StatusOK || body != "fresh" {
+			t.Fatalf("response %d = %d %q, want 200 %q", i, status, body, "fresh")
+		}
+	}
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Errorf("calls of downstream = %d, want 1", n)
+	}
+
+	// no-cache of request forces a request to downstream
+	get(t, rt, server.URL, "Cache-Control", "no-cache")
+	if n := atomic.LoadInt32(&calls); n != 2 {
+		t.Errorf("calls of downstream with no-cache = %d, want 2", n)
+	}
+}
+
+func TestTransportRevalidatesStaleResponse(t *testing.T) {
+	var calls, notModified int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.Header().Set("Cache-Control", "max-age=0")
+		w.Header().Set("ETag", `"v1"`)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			atomic.AddInt32(&notModified, 1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Write([]byte("v1"))
+	}))
+	defer server.Close()
+	rt := &Transport{Cache: New(10)}
+
+	for i := 0; i < 3; i++ {
+		if status, body := get(t, rt, server.URL); status != http.StatusOK || body != "v1" {
+			t.Fatalf("response %d = %d %q, want 200 %q", i, status, body, "v1")
+		}
+	}
+	if n, m := atomic.LoadInt32(&calls), atomic.LoadInt32(&notModified); n != 3 || m != 2 {
+		t.Errorf("calls of downstream = %d (%d not modified), want 3 (2 not modified)", n, m)
+	}
+}
+
+func TestTransportVary(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("Vary", "Accept-Language")
+		w.Write([]byte(r.Header.Get("Accept-Language")))
+	}))
+	defer server.Close()
+	rt := &Transport{Cache: New(10)}
+
+	for _, lang := range []string{"en", "fr", "en", "fr"} {
+		if _, body := get(t, rt, server.URL, "Accept-Language", lang); body != lang {
+			t.Errorf("response of %s = %q, want %q", lang, body, lang)
+		}
+	}
+	if n := atomic.LoadInt32(&calls); n != 2 {
+		t.Errorf("calls of downstream = %d, want 2", n)
+	}
+}
+
+func TestTransportDoesNotShareAuthorizedResponse(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Write([]byte(r.Header.Get("Authorization")))
+	}))
+	defer server.Close()
+	rt := &Transport{Cache: New(10)}
+
+	get(t, rt, server.URL, "Authorization", "Bearer alice")
+	if _, body := get(t, rt, server.URL, "Authorization", "Bearer bob"); body != "Bearer bob" {
+		t.Errorf("response of bob = %q, want %q", body, "Bearer bob")
+	}
+	if n := atomic.LoadInt32(&calls); n != 2 {
+		t.Errorf("calls of downstream = %d, want 2", n)
+	}
+}
+
+func TestTransportInvalidatesOnUnsafeMethod(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			atomic.AddInt32(&calls, 1)
+		}
+		w.Header().Set("Cache-Control", "max-age=60")
+	}))
+	defer server.Close()
+	rt := &Transport{Cache: New(10)}
+
+	get(t, rt, server.URL)
+	req, _ := http.NewRequest(http.MethodPost, server.URL, nil)
+	res, err := rt.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("POST %s:: %v", server.URL, err)
+	}
+	res.Body.Close()
+	get(t, rt, server.URL)
+
+	if n := atomic.LoadInt32(&calls); n != 2 {
+		t.Errorf("GET calls of downstream = %d, want 2", n)
+	}
+}
@@ -0,0 +1,278 @@
+package logging
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/linushung/artemis/internal/pkg/configs"
+)
+
+// Formats of logging.format
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// Subsystems of Artemis with their own loggers, see Logger
+const (
+	Postgres       = "postgres"
+	CircuitBreaker = "circuitbreaker"
+	JWT            = "jwt"
+	REST           = "rest"
+)
+
+const (
+	timestampFormat     = "2006-01-02 15:04:05.000"
+	defaultCloseTimeout = 5 * time.Second
+)
+
+var (
+	// ErrUnknownSubsystem returns when level of a subsystem without logger is changed
+	ErrUnknownSubsystem = errors.New("unknown subsystem")
+
+	mu sync.Mutex
+	// loggers of subsystems, and levels of subsystems overriding the global level
+	loggers   = map[string]*log.Logger{}
+	overrides = map[string]log.Level{}
+	// sinks is the dispatcher of "logging.sinks", nil if entries are written to stdout by loggers
+	sinks *dispatcher
+)
+
+/*
+Logger returns the logger of subsystem, so its level can be changed independently of the global level. It shares
+output, formatter and hooks with the standard logger of logrus, hence it can be declared as a package variable before
+Configure is called.
+*/
+func Logger(subsystem string) *log.Logger {
+	mu.Lock()
+	defer mu.Unlock()
+
+	subsystem = strings.ToLower(subsystem)
+	if l, ok := loggers[subsystem]; ok {
+		return l
+	}
+
+	std := log.StandardLogger()
+	l := &log.Logger{
+		Out:       std.Out,
+		Formatter: std.Formatter,
+		// Hooks added to the standard logger later are shared since LevelHooks is a map
+		Hooks:        std.Hooks,
+		Level:        std.GetLevel(),
+		ReportCaller: std.ReportCaller,
+		ExitFunc:     std.ExitFunc,
+	}
+	loggers[subsystem] = l
+	return l
+}
+
+// Config represents "logging"
+type Config struct {
+	// Level is one of "trace", "debug" (default), "info", "warn" and "error"
+	Level string `mapstructure:"level"`
+	// Format is "text" (default) or "json" of stdout if no sinks are configured
+	Format string `mapstructure:"format"`
+	// Subsystems are levels of subsystems overriding Level, e.g. {postgres: warn}
+	Subsystems map[string]string `mapstructure:"subsystems"`
+	Sinks      []SinkConfig      `mapstructure:"sinks"`
+	Sampling   SamplingConfig    `mapstructure:"sampling"`
+	Redaction  RedactionConfig   `mapstructure:"redaction"`
+}
+
+// settings are parsed from Config
+type settings struct {
+	level      log.Level
+	format     string
+	subsystems map[string]log.Level
+	redactor   *Redactor
+}
+
+func parse(c Config) (settings, error) {
+	var errs configs.Errors
+	s := settings{level: log.DebugLevel, subsystems: map[string]log.Level{}}
+	if c.Level != "" {
+		l, err := log.ParseLevel(c.Level)
+		errs.Add("level", err)
+		s.level = l
+	}
+
+	switch s.format = strings.ToLower(c.Format); s.format {
+	case "", FormatText, FormatJSON:
+	default:
+		errs.Addf("format", "must be text or json, got %q", c.Format)
+	}
+
+	mu.Lock()
+	for subsystem, level := range c.Subsystems {
+		if _, ok := loggers[strings.ToLower(subsystem)]; !ok {
+			errs.Add("subsystems."+subsystem, ErrUnknownSubsystem)
+			continue
+		}
+		l, err := log.ParseLevel(level)
+		errs.Add("subsystems."+subsystem, err)
+		s.subsystems[strings.ToLower(subsystem)] = l
+	}
+	mu.Unlock()
+
+	for n, sink := range c.Sinks {
+		errs.Add(fmt.Sprintf("sinks[%d]", n), sink.validate())
+	}
+	for _, level := range c.Sampling.Levels {
+		if _, err := log.ParseLevel(level); err != nil {
+			errs.Add("sampling.levels", err)
+		}
+	}
+	r, err := NewRedactor(c.Redaction)
+	errs.Add("redaction.patterns", err)
+	s.redactor = r
+	return s, errs.Err()
+}
+
+// Validate checks levels, formats, sinks and redaction patterns of c without applying it, sinks aren't opened
+func (c Config) Validate() error {
+	_, err := parse(c)
+	return err
+}
+
+/*
+Configure sets up the standard logger of logrus and loggers of subsystems by c:
+1. level is the global level, "debug" by default, and subsystems overrides it per subsystem, e.g. {postgres: warn}.
+2. format is "text" (default) or "json" of stdout if no sinks are configured.
+3. sampling drops high-volume entries of sampled levels, see SamplingConfig.
+4. sinks replace stdout with several destinations, see SinkConfig. Call Close to flush them on shutdown.
+5. redaction replaces fields and patterns of Hook without its own Redactor, see Init.
+Configure can be called again to apply changes of configuration, levels changed at runtime are reset.
+*/
+func Configure(c Config) error {
+	s, err := parse(c)
+	if err != nil {
+		return err
+	}
+
+	var formatter log.Formatter
+	if s.format == FormatJSON {
+		formatter = &log.JSONFormatter{TimestampFormat: timestampFormat}
+	} else {
+		formatter = &log.TextFormatter{TimestampFormat: timestampFormat, FullTimestamp: true}
+	}
+	var d *dispatcher
+	if len(c.Sinks) > 0 {
+		if d, err = newDispatcher(c.Sinks); err != nil {
+			return err
+		}
+		formatter = d
+	}
+	if c.Sampling.Enabled {
+		formatter = newSampler(formatter, c.Sampling.WithDefaults())
+	}
+
+	mu.Lock()
+	log.SetFormatter(formatter)
+	log.SetLevel(s.level)
+	overrides = map[string]log.Level{}
+	for name, l := range loggers {
+		l.SetFormatter(formatter)
+		l.SetOutput(log.StandardLogger().Out)
+		if level, ok := s.subsystems[name]; ok {
+			overrides[name] = level
+			l.SetLevel(level)
+		} else {
+			l.SetLevel(s.level)
+		}
+	}
+	previous := sinks
+	sinks = d
+	mu.Unlock()
+	useRedactor(s.redactor, c.Redaction.Disabled)
+	if previous != nil {
+		previous.close(defaultCloseTimeout)
+	}
+	return nil
+}
+
+/*
+SetLevel changes level of subsystem at runtime. An empty subsystem changes the global level, which applies to the
+standard logger and subsystems without their own level. Level "reset" makes subsystem follow the global level again.
+*/
+func SetLevel(subsystem, level string) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	subsystem = strings.ToLower(subsystem)
+	if subsystem == "" {
+		l, err := log.ParseLevel(level)
+		if err != nil {
+			return err
+		}
+		log.SetLevel(l)
+		for name, logger := range loggers {
+			if _, ok := overrides[name]; !ok {
+				logger.SetLevel(l)
+			}
+		}
+		return nil
+	}
+
+	logger, ok := loggers[subsystem]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownSubsystem, subsystem)
+	}
+	if level == "reset" {
+		delete(overrides, subsystem)
+		logger.SetLevel(log.GetLevel())
+		return nil
+	}
+	l, err := log.ParseLevel(level)
+	if err != nil {
+		return err
+	}
+	overrides[subsystem] = l
+	logger.SetLevel(l)
+	return nil
+}
+
+// Levels represents the global level and levels of subsystems
+type Levels struct {
+	Global     string            `json:"global"`
+	Subsystems map[string]string `json:"subsystems"`
+	// Overridden lists subsystems whose level doesn't follow the global level
+	Overridden []string `json:"overridden"`
+}
+
+// GetLevels returns the current levels
+func GetLevels() Levels {
+	mu.Lock()
+	defer mu.Unlock()
+
+	levels := Levels{Global: log.GetLevel().String(), Subsystems: map[string]string{}, Overridden: []string{}}
+	for name, logger := range loggers {
+		levels.Subsystems[name] = logger.GetLevel().String()
+	}
+	for name := range overrides {
+		levels.Overridden = append(levels.Overridden, name)
+	}
+	sort.Strings(levels.Overridden)
+	return levels
+}
+
+// Close flushes entries queued by sinks within timeout and closes them, it's also called when logrus exits on Fatal
+func Close(timeout time.Duration) {
+	mu.Lock()
+	d := sinks
+	sinks = nil
+	mu.Unlock()
+
+	if d != nil {
+		d.close(timeout)
+	}
+}
+
+func init() {
+	log.RegisterExitHandler(func() { Close(defaultCloseTimeout) })
+}
@@ -0,0 +1,56 @@
+package logging
+
+import (
+	"errors"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+)
+
+func TestSetLevel(t *testing.T) {
+	global := log.GetLevel()
+	defer func() {
+		SetLevel(Postgres, "reset")
+		SetLevel("", global.String())
+	}()
+	Logger(Postgres)
+	Logger(REST)
+	Logger(JWT)
+
+	tests := []struct {
+		name      string
+		subsystem string
+		level     string
+		valid     bool
+		// want are levels of global ("") and subsystems after the change
+		want map[string]log.Level
+	}{
+		{"global", "", "info", true, map[string]log.Level{"": log.InfoLevel, Postgres: log.InfoLevel, REST: log.InfoLevel, JWT: log.InfoLevel}},
+		{"one subsystem", Postgres, "warn", true, map[string]log.Level{"": log.InfoLevel, Postgres: log.WarnLevel, REST: log.InfoLevel, JWT: log.InfoLevel}},
+		{"global keeps overridden subsystem", "", "error", true, map[string]log.Level{"": log.ErrorLevel, Postgres: log.WarnLevel, REST: log.ErrorLevel, JWT: log.ErrorLevel}},
+		{"another subsystem", "REST", "debug", true, map[string]log.Level{"": log.ErrorLevel, Postgres: log.WarnLevel, REST: log.DebugLevel, JWT: log.ErrorLevel}},
+		{"reset", Postgres, "reset", true, map[string]log.Level{"": log.ErrorLevel, Postgres: log.ErrorLevel, REST: log.DebugLevel, JWT: log.ErrorLevel}},
+		{"unknown subsystem", "cache", "info", false, map[string]log.Level{"": log.ErrorLevel, Postgres: log.ErrorLevel, REST: log.DebugLevel, JWT: log.ErrorLevel}},
+		{"invalid level", JWT, "verbose", false, map[string]log.Level{"": log.ErrorLevel, Postgres: log.ErrorLevel, REST: log.DebugLevel, JWT: log.ErrorLevel}},
+	}
+	for _, tt := range tests {
+		if err := SetLevel(tt.subsystem, tt.level); (err == nil) != tt.valid {
+			t.Errorf("%s: SetLevel(%q, %q) = %v, want valid %v", tt.name, tt.subsystem, tt.level, err, tt.valid)
+		}
+
+		levels := GetLevels()
+		for subsystem, want := range tt.want {
+			got := levels.Global
+			if subsystem != "" {
+				got = levels.Subsystems[subsystem]
+			}
+			if got != want.String() {
+				t.Errorf("%s: level of [%s] = %s, want %s", tt.name, subsystem, got, want)
+			}
+		}
+	}
+
+	if err := SetLevel("cache", "info"); !errors.Is(err, ErrUnknownSubsystem) {
+		t.Errorf("SetLevel of unknown subsystem = %v, want %v", err, ErrUnknownSubsystem)
+	}
+}
@@ -0,0 +1,114 @@
+package logging
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultSamplingInitial    = 100
+	defaultSamplingThereafter = 100
+	defaultSamplingTick       = time.Second
+	// maxSampledKeys bounds counters of a tick, entries of further keys are sampled as a single key
+	maxSampledKeys = 4096
+	overflowKey    = "overflow"
+)
+
+/*
+SamplingConfig represents "logging.sampling". In every Tick, the first Initial entries of the same level and tag are
+logged, and then only one of every Thereafter entries, e.g. 100 and 100 log at most ~ 100 + (n - 100) / 100 entries
+of a tag per second. Tag is the "***** [TAG] *****" prefix of a message, or the whole message if it has none.
+*/
+type SamplingConfig struct {
+	Enabled    bool          `mapstructure:"enabled" json:"enabled"`
+	Initial    int           `mapstructure:"initial" json:"initial"`
+	Thereafter int           `mapstructure:"thereafter" json:"thereafter"`
+	Tick       time.Duration `mapstructure:"tick" json:"tick"`
+	// Levels are sampled levels, "debug" and "info" by default. Warnings and errors should never be sampled
+	Levels []string `mapstructure:"levels" json:"levels"`
+}
+
+// WithDefaults returns a copy of c whose unset fields are replaced with default values
+func (c SamplingConfig) WithDefaults() SamplingConfig {
+	if c.Initial <= 0 {
+		c.Initial = defaultSamplingInitial
+	}
+	if c.Thereafter <= 0 {
+		c.Thereafter = defaultSamplingThereafter
+	}
+	if c.Tick <= 0 {
+		c.Tick = defaultSamplingTick
+	}
+	if len(c.Levels) == 0 {
+		c.Levels = []string{log.DebugLevel.String(), log.InfoLevel.String()}
+	}
+	return c
+}
+
+/*
+sampler is a formatter dropping entries over the sampling rate, since hooks of logrus can't drop entries. A dropped
+entry is formatted to nothing, so nothing is written to the output. NOTE: hooks still receive every entry.
+*/
+type sampler struct {
+	log.Formatter
+	config SamplingConfig
+	levels map[log.Level]bool
+
+	mu     sync.Mutex
+	tick   time.Time
+	counts map[string]int
+}
+
+func newSampler(f log.Formatter, c SamplingConfig) *sampler {
+	s := &sampler{Formatter: f, config: c, levels: map[log.Level]bool{}, counts: map[string]int{}}
+	for _, name := range c.Levels {
+		if l, err := log.ParseLevel(name); err == nil {
+			s.levels[l] = true
+		}
+	}
+	return s
+}
+
+// tagOf returns "***** [TAG] *****" prefix of msg
+func tagOf(msg string) string {
+	const sep = "*****"
+	if strings.HasPrefix(msg, sep) {
+		if i := strings.Index(msg[len(sep):], sep); i >= 0 {
+			return msg[:len(sep)+i+len(sep)]
+		}
+	}
+	return msg
+}
+
+// sampled reports whether entry should be logged
+func (s *sampler) sampled(entry *log.Entry) bool {
+	if !s.levels[entry.Level] {
+		return true
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if now := entry.Time; now.Sub(s.tick) >= s.config.Tick {
+		s.tick = now
+		s.counts = map[string]int{}
+	}
+
+	key := entry.Level.String() + ":" + tagOf(entry.Message)
+	if _, ok := s.counts[key]; !ok && len(s.counts) >= maxSampledKeys {
+		key = overflowKey
+	}
+	s.counts[key]++
+	n := s.counts[key]
+	return n <= s.config.Initial || (n-s.config.Initial)%s.config.Thereafter == 0
+}
+
+// Format implements logrus.Formatter
+func (s *sampler) Format(entry *log.Entry) ([]byte, error) {
+	if !s.sampled(entry) {
+		return nil, nil
+	}
+	return s.Formatter.Format(entry)
+}
@@ -0,0 +1,72 @@
+package logging
+
+import (
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+func TestSamplerCapsEntriesPerTick(t *testing.T) {
+	s := newSampler(&log.TextFormatter{}, SamplingConfig{Initial: 3, Thereafter: 5, Tick: time.Second}.WithDefaults())
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	logged := func(level log.Level, msg string, at time.Time, n int) int {
+		count := 0
+		for i := 0; i < n; i++ {
+			if s.sampled(&log.Entry{Level: level, Message: msg, Time: at}) {
+				count++
+			}
+		}
+		return count
+	}
+
+	tests := []struct {
+		name   string
+		level  log.Level
+		msg    string
+		at     time.Time
+		n      int
+		logged int
+	}{
+		// 3 initial entries and then the 5th and 10th of the following 10
+		{"initial and thereafter", log.InfoLevel, "***** [CIRCUITBREAKER] ***** request 1", start, 13, 5},
+		{"same tag is counted together", log.InfoLevel, "***** [CIRCUITBREAKER] ***** request 2", start, 5, 1},
+		{"another tag", log.InfoLevel, "***** [DATABASE] ***** query", start, 3, 3},
+		{"another level", log.DebugLevel, "***** [CIRCUITBREAKER] ***** request 1", start, 3, 3},
+		{"level not sampled", log.WarnLevel, "***** [CIRCUITBREAKER] ***** request 1", start, 100, 100},
+		{"within tick", log.InfoLevel, "***** [CIRCUITBREAKER] ***** request 3", start.Add(999 * time.Millisecond), 5, 1},
+		{"next tick", log.InfoLevel, "***** [CIRCUITBREAKER] ***** request 1", start.Add(time.Second), 13, 5},
+	}
+	for _, tt := range tests {
+		if n := logged(tt.level, tt.msg, tt.at, tt.n); n != tt.logged {
+			t.Errorf("%s: logged %d of %d entries, want %d", tt.name, n, tt.n, tt.logged)
+		}
+	}
+}
+
+func TestSamplerFormat(t *testing.T) {
+	s := newSampler(&log.TextFormatter{DisableTimestamp: true}, SamplingConfig{Initial: 1, Thereafter: 100}.WithDefaults())
+	entry := &log.Entry{Logger: log.New(), Level: log.InfoLevel, Message: "hello", Time: time.Now(), Data: log.Fields{}}
+
+	if b, err := s.Format(entry); err != nil || len(b) == 0 {
+		t.Errorf("Format of sampled entry = %q, %v, want formatted", b, err)
+	}
+	if b, err := s.Format(entry); err != nil || len(b) != 0 {
+		t.Errorf("Format of dropped entry = %q, %v, want nothing", b, err)
+	}
+}
+
+func TestTagOf(t *testing.T) {
+	tests := []struct {
+		msg, tag string
+	}{
+		{"***** [DATABASE][FAIL] ***** Failed to connect", "***** [DATABASE][FAIL] *****"},
+		{"plain message", "plain message"},
+		{"***** unterminated", "***** unterminated"},
+	}
+	for _, tt := range tests {
+		if tag := tagOf(tt.msg); tag != tt.tag {
+			t.Errorf("tagOf(%q) = %q, want %q", tt.msg, tag, tt.tag)
+		}
+	}
+}
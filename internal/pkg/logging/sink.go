@@ -0,0 +1,327 @@
+package logging
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	logrustash "github.com/bshuster-repo/logrus-logstash-hook"
+	log "github.com/sirupsen/logrus"
+)
+
+// Types of sinks
+const (
+	SinkStdout   = "stdout"
+	SinkFile     = "file"
+	SinkLogstash = "logstash"
+	SinkSyslog   = "syslog"
+)
+
+// FormatLogstash is the JSON format of logstash, one event per line
+const FormatLogstash = "logstash"
+
+const (
+	defaultSinkQueue = 1024
+	// flushInterval is how often sinks buffering entries, e.g. a disconnected logstash, retry to flush them
+	flushInterval = time.Second
+	appName       = "artemis"
+)
+
+/*
+SinkConfig represents a sink of "logging.sinks". Every sink formats entries of Level or above in its own Format and
+writes them asynchronously through a queue of Queue entries, entries are dropped if the queue is full so that a slow
+sink never blocks requests.
+*/
+type SinkConfig struct {
+	// Type is one of "stdout", "file", "logstash" and "syslog"
+	Type string `mapstructure:"type" json:"type"`
+	// Level is the minimum level written to the sink, all entries passing level of loggers by default
+	Level string `mapstructure:"level" json:"level"`
+	// Format is one of "text", "json" and "logstash", "json" by default but "logstash" of logstash and "text" of syslog
+	Format string `mapstructure:"format" json:"format"`
+	Queue  int    `mapstructure:"queue" json:"queue"`
+	// Path, MaxSize (megabytes), MaxAge (days), MaxBackups and Compress are retention of rotating files of type "file"
+	Path       string `mapstructure:"path" json:"path"`
+	MaxSize    int    `mapstructure:"maxsize" json:"maxSize"`
+	MaxAge     int    `mapstructure:"maxage" json:"maxAge"`
+	MaxBackups int    `mapstructure:"maxbackups" json:"maxBackups"`
+	Compress   bool   `mapstructure:"compress" json:"compress"`
+	// Network and Address of "logstash" ("tcp" by default) and "syslog" (local syslog if empty)
+	Network string `mapstructure:"network" json:"network"`
+	Address string `mapstructure:"address" json:"address"`
+	// Buffer is the number of entries kept while logstash is disconnected, the oldest ones are dropped when it's full
+	Buffer            int           `mapstructure:"buffer" json:"buffer"`
+	ReconnectDelay    time.Duration `mapstructure:"reconnectdelay" json:"reconnectDelay"`
+	MaxReconnectDelay time.Duration `mapstructure:"maxreconnectdelay" json:"maxReconnectDelay"`
+	// Tag and Facility of "syslog", e.g. "local0"
+	Tag      string `mapstructure:"tag" json:"tag"`
+	Facility string `mapstructure:"facility" json:"facility"`
+}
+
+// Sink writes formatted entries to a destination, it's called by a single goroutine
+type Sink interface {
+	Write(level log.Level, line []byte) error
+	Close() error
+}
+
+// flusher is implemented by sinks buffering entries
+type flusher interface {
+	Flush() error
+}
+
+// newSink creates the sink of c
+func newSink(c SinkConfig) (Sink, error) {
+	switch strings.ToLower(c.Type) {
+	case SinkStdout:
+		return writerSink{os.Stdout}, nil
+	case SinkFile:
+		return newFileSink(c)
+	case SinkLogstash:
+		return newLogstashSink(c)
+	case SinkSyslog:
+		return newSyslogSink(c)
+	default:
+		return nil, fmt.Errorf("unknown sink type %q", c.Type)
+	}
+}
+
+// validate checks c without creating the sink, e.g. a candidate configuration of hot reload
+func (c SinkConfig) validate() error {
+	switch strings.ToLower(c.Type) {
+	case SinkStdout:
+	case SinkSyslog:
+		if err := validateSyslog(c); err != nil {
+			return err
+		}
+	case SinkFile:
+		if c.Path == "" {
+			return errors.New("path of file sink is required")
+		}
+	case SinkLogstash:
+		if c.Address == "" {
+			return errors.New("address of logstash sink is required")
+		}
+	default:
+		return fmt.Errorf("unknown sink type %q", c.Type)
+	}
+	if c.Level != "" {
+		if _, err := log.ParseLevel(c.Level); err != nil {
+			return fmt.Errorf("invalid level of sink %s: %w", c.Type, err)
+		}
+	}
+	_, err := sinkFormatter(c)
+	return err
+}
+
+func sinkFormatter(c SinkConfig) (log.Formatter, error) {
+	format := strings.ToLower(c.Format)
+	if format == "" {
+		switch strings.ToLower(c.Type) {
+		case SinkLogstash:
+			format = FormatLogstash
+		case SinkSyslog:
+			format = FormatText
+		default:
+			format = FormatJSON
+		}
+	}
+
+	switch format {
+	case FormatText:
+		return &log.TextFormatter{TimestampFormat: timestampFormat, FullTimestamp: true, DisableColors: true}, nil
+	case FormatJSON:
+		return &log.JSONFormatter{TimestampFormat: timestampFormat}, nil
+	case FormatLogstash:
+		return &logrustash.LogstashFormatter{Type: appName}, nil
+	default:
+		return nil, fmt.Errorf("unknown format %q of sink %s", c.Format, c.Type)
+	}
+}
+
+type record struct {
+	level log.Level
+	line  []byte
+}
+
+// asyncSink formats entries synchronously and writes them to Sink by its own goroutine
+type asyncSink struct {
+	name      string
+	sink      Sink
+	formatter log.Formatter
+	level     log.Level
+
+	mu      sync.RWMutex
+	closed  bool
+	queue   chan record
+	done    chan struct{}
+	dropped uint64
+	lastErr string
+}
+
+func newAsyncSink(c SinkConfig) (*asyncSink, error) {
+	formatter, err := sinkFormatter(c)
+	if err != nil {
+		return nil, err
+	}
+	level := log.TraceLevel
+	if c.Level != "" {
+		if level, err = log.ParseLevel(c.Level); err != nil {
+			return nil, fmt.Errorf("invalid level of sink %s: %w", c.Type, err)
+		}
+	}
+	queue := c.Queue
+	if queue <= 0 {
+		queue = defaultSinkQueue
+	}
+	sink, err := newSink(c)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &asyncSink{
+		name:      strings.ToLower(c.Type),
+		sink:      sink,
+		formatter: formatter,
+		level:     level,
+		queue:     make(chan record, queue),
+		done:      make(chan struct{}),
+	}
+	go s.run()
+	return s, nil
+}
+
+func (s *asyncSink) enqueue(entry *log.Entry) {
+	if entry.Level > s.level {
+		return
+	}
+
+	// Buffer of entry is shared by formatters and reused once the entry is written, so each sink formats into its own
+	e := *entry
+	e.Buffer = nil
+	line, err := s.formatter.Format(&e)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "***** [LOGGING:%s][FAIL] ***** Failed to format entry:: %v\n", s.name, err)
+		return
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return
+	}
+	select {
+	case s.queue <- record{entry.Level, line}:
+	default:
+		atomic.AddUint64(&s.dropped, 1)
+	}
+}
+
+// run writes queued entries until the queue is closed, then flushes and closes Sink, so Sink is only used by run
+func (s *asyncSink) run() {
+	defer close(s.done)
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	f, buffered := s.sink.(flusher)
+	for {
+		select {
+		case r, ok := <-s.queue:
+			if !ok {
+				if buffered {
+					s.report(f.Flush())
+				}
+				if dropped := atomic.LoadUint64(&s.dropped); dropped > 0 {
+					fmt.Fprintf(os.Stderr, "***** [LOGGING:%s] ***** %d entries were dropped since the queue was full\n", s.name, dropped)
+				}
+				s.report(s.sink.Close())
+				return
+			}
+			s.report(s.sink.Write(r.level, r.line))
+		case <-ticker.C:
+			if buffered {
+				s.report(f.Flush())
+			}
+		}
+	}
+}
+
+// report writes errors of sink to stderr once until it changes, since sinks can't log their own errors
+func (s *asyncSink) report(err error) {
+	if err == nil {
+		s.lastErr = ""
+		return
+	}
+	if err.Error() != s.lastErr {
+		s.lastErr = err.Error()
+		fmt.Fprintf(os.Stderr, "***** [LOGGING:%s][FAIL] ***** Failed to write entries:: %v\n", s.name, err)
+	}
+}
+
+/*
+close stops accepting entries and waits at most timeout for queued entries to be written and Sink to be closed. On
+timeout, or without waiting if timeout <= 0, run keeps writing the rest in background and closes Sink after them.
+*/
+func (s *asyncSink) close(timeout time.Duration) {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return
+	}
+	s.closed = true
+	close(s.queue)
+	s.mu.Unlock()
+
+	if timeout <= 0 {
+		return
+	}
+	select {
+	case <-s.done:
+	case <-time.After(timeout):
+		fmt.Fprintf(os.Stderr, "***** [LOGGING:%s][FAIL] ***** Timeout flushing %d queued entries\n", s.name, len(s.queue))
+	}
+}
+
+/*
+dispatcher is the formatter of loggers when sinks are configured. It runs after all hooks, e.g. redaction, and hands
+entries over to every sink, so nothing is written to the output of loggers.
+*/
+type dispatcher struct {
+	sinks []*asyncSink
+}
+
+func newDispatcher(configs []SinkConfig) (*dispatcher, error) {
+	d := &dispatcher{}
+	for _, c := range configs {
+		s, err := newAsyncSink(c)
+		if err != nil {
+			d.close(0)
+			return nil, err
+		}
+		d.sinks = append(d.sinks, s)
+	}
+	return d, nil
+}
+
+// Format implements logrus.Formatter
+func (d *dispatcher) Format(entry *log.Entry) ([]byte, error) {
+	for _, s := range d.sinks {
+		s.enqueue(entry)
+	}
+	return nil, nil
+}
+
+func (d *dispatcher) close(timeout time.Duration) {
+	var wg sync.WaitGroup
+	for _, s := range d.sinks {
+		wg.Add(1)
+		go func(s *asyncSink) {
+			defer wg.Done()
+			s.close(timeout)
+		}(s)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,113 @@
+package logging
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// fakeSink records calls, and blocks Write until release is closed
+type fakeSink struct {
+	release chan struct{}
+
+	mu     sync.Mutex
+	calls  []string
+	closed chan struct{}
+}
+
+func newFakeSink() *fakeSink {
+	return &fakeSink{release: make(chan struct{}), closed: make(chan struct{})}
+}
+
+func (f *fakeSink) record(call string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, call)
+}
+
+func (f *fakeSink) Write(_ log.Level, line []byte) error {
+	<-f.release
+	f.record(string(line))
+	return nil
+}
+
+func (f *fakeSink) Flush() error {
+	f.record("flush")
+	return nil
+}
+
+func (f *fakeSink) Close() error {
+	f.record("close")
+	close(f.closed)
+	return nil
+}
+
+func newTestAsyncSink(sink Sink) *asyncSink {
+	s := &asyncSink{
+		name:      "fake",
+		sink:      sink,
+		formatter: &log.TextFormatter{DisableTimestamp: true},
+		level:     log.TraceLevel,
+		queue:     make(chan record, 10),
+		done:      make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+func TestAsyncSinkCloseTimeout(t *testing.T) {
+	f := newFakeSink()
+	s := newTestAsyncSink(f)
+	for _, msg := range []string{"a", "b"} {
+		s.queue <- record{log.InfoLevel, []byte(msg)}
+	}
+
+	// Writes are blocked, so close times out while entries are queued
+	s.close(10 * time.Millisecond)
+	s.enqueue(&log.Entry{Level: log.InfoLevel, Message: "after close"})
+	f.mu.Lock()
+	if len(f.calls) != 0 {
+		t.Errorf("calls of sink before writes are released = %v, want none", f.calls)
+	}
+	f.mu.Unlock()
+
+	// Queued entries are still written, then sink is flushed and closed once
+	close(f.release)
+	select {
+	case <-f.closed:
+	case <-time.After(time.Second):
+		t.Fatal("sink isn't closed after queued entries are written")
+	}
+	<-s.done
+	want := []string{"a", "b", "flush", "close"}
+	if len(f.calls) != len(want) {
+		t.Fatalf("calls of sink = %v, want %v", f.calls, want)
+	}
+	for i := range want {
+		if f.calls[i] != want[i] {
+			t.Fatalf("calls of sink = %v, want %v", f.calls, want)
+		}
+	}
+
+	// Closing again is a no-op
+	s.close(10 * time.Millisecond)
+}
+
+func TestAsyncSinkClose(t *testing.T) {
+	f := newFakeSink()
+	close(f.release)
+	s := newTestAsyncSink(f)
+	s.enqueue(&log.Entry{Level: log.InfoLevel, Message: "hello"})
+
+	s.close(time.Second)
+	select {
+	case <-f.closed:
+	default:
+		t.Fatal("sink isn't closed when close returns")
+	}
+	if len(f.calls) != 3 || f.calls[2] != "close" {
+		t.Errorf("calls of sink = %v, want entry, flush and close", f.calls)
+	}
+}
@@ -0,0 +1,163 @@
+package logging
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	/* Ref: https://github.com/natefinch/lumberjack */
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+const (
+	defaultFileMaxSize               = 100
+	defaultLogstashNetwork           = "tcp"
+	defaultLogstashBuffer            = 10000
+	defaultLogstashReconnectDelay    = time.Second
+	defaultLogstashMaxReconnectDelay = 30 * time.Second
+	logstashTimeout                  = 5 * time.Second
+)
+
+// writerSink writes entries to an io.Writer, e.g. stdout
+type writerSink struct {
+	io.Writer
+}
+
+func (s writerSink) Write(_ log.Level, line []byte) error {
+	_, err := s.Writer.Write(line)
+	return err
+}
+
+func (s writerSink) Close() error {
+	if c, ok := s.Writer.(io.Closer); ok && s.Writer != os.Stdout {
+		return c.Close()
+	}
+	return nil
+}
+
+// newFileSink writes entries to a file rotated by size, old files are removed by age and number of backups
+func newFileSink(c SinkConfig) (Sink, error) {
+	if c.Path == "" {
+		return nil, errors.New("path of file sink is required")
+	}
+	maxSize := c.MaxSize
+	if maxSize <= 0 {
+		maxSize = defaultFileMaxSize
+	}
+
+	return writerSink{&lumberjack.Logger{
+		Filename:   c.Path,
+		MaxSize:    maxSize,
+		MaxAge:     c.MaxAge,
+		MaxBackups: c.MaxBackups,
+		Compress:   c.Compress,
+	}}, nil
+}
+
+/*
+logstashSink ships entries to logstash, e.g. its tcp input with json_lines codec. Unlike the UDP hook of logrustash,
+entries are kept in a bounded buffer while logstash is unreachable and sent once it's reconnected, and reconnecting
+backs off exponentially from ReconnectDelay to MaxReconnectDelay.
+*/
+type logstashSink struct {
+	network, address string
+	conn             net.Conn
+	pending          [][]byte
+	buffer           int
+	dropped          int
+
+	delay, minDelay, maxDelay time.Duration
+	nextDial                  time.Time
+}
+
+func newLogstashSink(c SinkConfig) (Sink, error) {
+	if c.Address == "" {
+		return nil, errors.New("address of logstash sink is required")
+	}
+
+	s := &logstashSink{
+		network:  c.Network,
+		address:  c.Address,
+		buffer:   c.Buffer,
+		minDelay: c.ReconnectDelay,
+		maxDelay: c.MaxReconnectDelay,
+	}
+	if s.network == "" {
+		s.network = defaultLogstashNetwork
+	}
+	if s.buffer <= 0 {
+		s.buffer = defaultLogstashBuffer
+	}
+	if s.minDelay <= 0 {
+		s.minDelay = defaultLogstashReconnectDelay
+	}
+	if s.maxDelay <= 0 {
+		s.maxDelay = defaultLogstashMaxReconnectDelay
+	}
+	s.delay = s.minDelay
+	return s, nil
+}
+
+func (s *logstashSink) Write(_ log.Level, line []byte) error {
+	if len(s.pending) >= s.buffer {
+		s.pending = s.pending[1:]
+		s.dropped++
+	}
+	s.pending = append(s.pending, line)
+	return s.Flush()
+}
+
+// Flush sends pending entries, reconnecting to logstash if it's disconnected and the backoff has elapsed
+func (s *logstashSink) Flush() error {
+	if len(s.pending) == 0 {
+		return nil
+	}
+	if s.conn == nil {
+		if time.Now().Before(s.nextDial) {
+			return nil
+		}
+		conn, err := net.DialTimeout(s.network, s.address, logstashTimeout)
+		if err != nil {
+			s.backoff()
+			return fmt.Errorf("cannot connect to logstash %s (%d entries buffered): %w", s.address, len(s.pending), err)
+		}
+		s.conn, s.delay = conn, s.minDelay
+		if s.dropped > 0 {
+			fmt.Fprintf(os.Stderr, "***** [LOGGING:logstash] ***** %d entries were dropped while disconnected\n", s.dropped)
+			s.dropped = 0
+		}
+	}
+
+	for len(s.pending) > 0 {
+		s.conn.SetWriteDeadline(time.Now().Add(logstashTimeout))
+		if _, err := s.conn.Write(s.pending[0]); err != nil {
+			s.conn.Close()
+			s.conn = nil
+			s.backoff()
+			return fmt.Errorf("cannot write to logstash %s: %w", s.address, err)
+		}
+		s.pending = s.pending[1:]
+	}
+	return nil
+}
+
+func (s *logstashSink) backoff() {
+	s.nextDial = time.Now().Add(s.delay)
+	if s.delay *= 2; s.delay > s.maxDelay {
+		s.delay = s.maxDelay
+	}
+}
+
+// Close makes a last attempt to send pending entries regardless of backoff
+func (s *logstashSink) Close() error {
+	s.nextDial = time.Time{}
+	err := s.Flush()
+	if s.conn != nil {
+		s.conn.Close()
+	}
+	return err
+}
@@ -0,0 +1,76 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package logging
+
+import (
+	"fmt"
+	/* Ref: https://golang.org/pkg/log/syslog/ */
+	"log/syslog"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var facilities = map[string]syslog.Priority{
+	"kern": syslog.LOG_KERN, "user": syslog.LOG_USER, "mail": syslog.LOG_MAIL, "daemon": syslog.LOG_DAEMON,
+	"auth": syslog.LOG_AUTH, "syslog": syslog.LOG_SYSLOG, "local0": syslog.LOG_LOCAL0, "local1": syslog.LOG_LOCAL1,
+	"local2": syslog.LOG_LOCAL2, "local3": syslog.LOG_LOCAL3, "local4": syslog.LOG_LOCAL4, "local5": syslog.LOG_LOCAL5,
+	"local6": syslog.LOG_LOCAL6, "local7": syslog.LOG_LOCAL7,
+}
+
+// syslogSink writes entries to syslog with severity mapped from their level
+type syslogSink struct {
+	*syslog.Writer
+}
+
+// facilityOf returns the facility of c, "user" by default
+func facilityOf(c SinkConfig) (syslog.Priority, error) {
+	if c.Facility == "" {
+		return syslog.LOG_USER, nil
+	}
+	f, ok := facilities[strings.ToLower(c.Facility)]
+	if !ok {
+		return 0, fmt.Errorf("unknown syslog facility %q", c.Facility)
+	}
+	return f, nil
+}
+
+// validateSyslog checks c of syslog sink without dialing syslog
+func validateSyslog(c SinkConfig) error {
+	_, err := facilityOf(c)
+	return err
+}
+
+func newSyslogSink(c SinkConfig) (Sink, error) {
+	facility, err := facilityOf(c)
+	if err != nil {
+		return nil, err
+	}
+	tag := c.Tag
+	if tag == "" {
+		tag = appName
+	}
+
+	w, err := syslog.Dial(c.Network, c.Address, facility|syslog.LOG_INFO, tag)
+	if err != nil {
+		return nil, err
+	}
+	return syslogSink{w}, nil
+}
+
+func (s syslogSink) Write(level log.Level, line []byte) error {
+	msg := strings.TrimSuffix(string(line), "\n")
+	switch level {
+	case log.PanicLevel, log.FatalLevel:
+		return s.Crit(msg)
+	case log.ErrorLevel:
+		return s.Err(msg)
+	case log.WarnLevel:
+		return s.Warning(msg)
+	case log.InfoLevel:
+		return s.Info(msg)
+	default:
+		return s.Debug(msg)
+	}
+}
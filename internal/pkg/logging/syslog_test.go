@@ -0,0 +1,30 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package logging
+
+import "testing"
+
+func TestSinkConfigValidateSyslog(t *testing.T) {
+	tests := []struct {
+		facility string
+		valid    bool
+	}{
+		{"", true},
+		{"local0", true},
+		{"LOCAL7", true},
+		{"daemon", true},
+		{"local8", false},
+		{"kernel", false},
+	}
+	for _, tt := range tests {
+		c := SinkConfig{Type: SinkSyslog, Facility: tt.facility}
+		if err := c.validate(); (err == nil) != tt.valid {
+			t.Errorf("validate of facility %q = %v, want valid %v", tt.facility, err, tt.valid)
+		}
+		// Candidate configuration of hot reload is rejected before the sink is opened
+		if err := (Config{Sinks: []SinkConfig{c}}).Validate(); (err == nil) != tt.valid {
+			t.Errorf("Validate of facility %q = %v, want valid %v", tt.facility, err, tt.valid)
+		}
+	}
+}
@@ -0,0 +1,16 @@
+//go:build windows || plan9
+// +build windows plan9
+
+package logging
+
+import "errors"
+
+var errSyslogUnsupported = errors.New("syslog sink is not supported on this platform")
+
+func validateSyslog(c SinkConfig) error {
+	return errSyslogUnsupported
+}
+
+func newSyslogSink(c SinkConfig) (Sink, error) {
+	return nil, errSyslogUnsupported
+}
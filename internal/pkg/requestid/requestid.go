@@ -0,0 +1,96 @@
+/*
+Package requestid correlates logs of a request across Artemis and its downstreams by X-Request-ID. The ID of an
+inbound request is kept in its context, added to entries logged with that context by LogHook and forwarded to
+downstreams by Transport.
+*/
+package requestid
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+)
+
+// Header is the header carrying request ID of inbound and outbound requests
+const Header = "X-Request-ID"
+
+// maxLength bounds request IDs accepted from clients, so a huge header isn't copied into every log entry
+const maxLength = 128
+
+type ctxKey struct{}
+
+// New generates a request ID
+func New() string {
+	return uuid.New().String()
+}
+
+// Valid reports whether id received from a client can be reused, i.e. it's not empty, not too long and printable
+func Valid(id string) bool {
+	if id == "" || len(id) > maxLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// NewContext returns a copy of ctx carrying request ID
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, ctxKey{}, id)
+}
+
+// FromContext returns the request ID of ctx, or an empty string if there is none
+func FromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(ctxKey{}).(string)
+	return id
+}
+
+// LogHook adds request_id to entries logged with the context of a request, e.g. log.WithContext(ctx)
+type LogHook struct{}
+
+// Levels implements logrus.Hook
+func (LogHook) Levels() []log.Level {
+	return log.AllLevels
+}
+
+// Fire implements logrus.Hook
+func (LogHook) Fire(entry *log.Entry) error {
+	if id := FromContext(entry.Context); id != "" {
+		entry.Data["request_id"] = id
+	}
+	return nil
+}
+
+// Transport is a http.RoundTripper setting X-Request-ID of requests made by Base from their context
+type Transport struct {
+	Base http.RoundTripper
+}
+
+// WrapTransport returns Transport over base, http.DefaultTransport is used if base is nil
+func WrapTransport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &Transport{Base: base}
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	id := FromContext(req.Context())
+	if id == "" || req.Header.Get(Header) != "" {
+		return t.Base.RoundTrip(req)
+	}
+
+	// RoundTripper must not modify the request, see http.RoundTripper
+	req = req.Clone(req.Context())
+	req.Header.Set(Header, id)
+	return t.Base.RoundTrip(req)
+}
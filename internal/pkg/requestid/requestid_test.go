@@ -0,0 +1,105 @@
+package requestid
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+)
+
+func TestValid(t *testing.T) {
+	tests := []struct {
+		name  string
+		id    string
+		valid bool
+	}{
+		{"uuid", New(), true},
+		{"printable", "req-1:abc/DEF_~!", true},
+		{"max length", strings.Repeat("a", maxLength), true},
+		{"empty", "", false},
+		{"too long", strings.Repeat("a", maxLength+1), false},
+		{"space", "req 1", false},
+		{"control", "req-1\r\nX-Admin: true", false},
+		{"delete", "req-1\x7f", false},
+		{"non ascii", "réq-1", false},
+	}
+	for _, tt := range tests {
+		if valid := Valid(tt.id); valid != tt.valid {
+			t.Errorf("%s: Valid(%q) = %v, want %v", tt.name, tt.id, valid, tt.valid)
+		}
+	}
+}
+
+func TestContext(t *testing.T) {
+	if id := FromContext(context.Background()); id != "" {
+		t.Errorf("FromContext without request ID = %q, want empty", id)
+	}
+	if id := FromContext(nil); id != "" {
+		t.Errorf("FromContext(nil) = %q, want empty", id)
+	}
+	if id := FromContext(NewContext(context.Background(), "req-1")); id != "req-1" {
+		t.Errorf("FromContext = %q, want %q", id, "req-1")
+	}
+}
+
+func TestLogHook(t *testing.T) {
+	var buf bytes.Buffer
+	logger := log.New()
+	logger.SetOutput(&buf)
+	logger.SetFormatter(&log.JSONFormatter{})
+	logger.AddHook(LogHook{})
+
+	logger.WithContext(NewContext(context.Background(), "req-1")).Info("with request ID")
+	if !strings.Contains(buf.String(), `"request_id":"req-1"`) {
+		t.Errorf("entry with context of request = %s, want request_id", buf.String())
+	}
+
+	buf.Reset()
+	logger.WithContext(context.Background()).Info("without request ID")
+	logger.Info("without context")
+	if strings.Contains(buf.String(), "request_id") {
+		t.Errorf("entries without request ID = %s, want no request_id", buf.String())
+	}
+}
+
+func TestTransport(t *testing.T) {
+	var received string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Get(Header)
+	}))
+	defer srv.Close()
+	client := &http.Client{Transport: WrapTransport(nil)}
+
+	tests := []struct {
+		name   string
+		ctx    context.Context
+		header string
+		want   string
+	}{
+		{"forwarded", NewContext(context.Background(), "req-1"), "", "req-1"},
+		{"set by caller", NewContext(context.Background(), "req-1"), "req-2", "req-2"},
+		{"without request ID", context.Background(), "", ""},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequestWithContext(tt.ctx, http.MethodGet, srv.URL, nil)
+		if tt.header != "" {
+			req.Header.Set(Header, tt.header)
+		}
+
+		res, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("%s: Do:: %v", tt.name, err)
+		}
+		res.Body.Close()
+		if received != tt.want {
+			t.Errorf("%s: %s received = %q, want %q", tt.name, Header, received, tt.want)
+		}
+		if tt.header == "" && req.Header.Get(Header) != "" {
+			t.Errorf("%s: request of caller is modified", tt.name)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+/*
+Package stub provides an in-process downstream reproducing the endpoints of httpbin which Artemis uses to exercise
+circuit breakers offline:
+1. /status/{codes} responds with the status code, or a random one of comma-separated codes, e.g. /status/200,500.
+2. /delay/{seconds} responds after the delay of at most MaxDelay, or when the request is cancelled.
+3. /flaky?failure=0.5&status=503 fails with status (default 500) at the rate of failure (default 0.5).
+4. /cache/{seconds} responds with "Cache-Control: public, max-age=seconds" and an ETag, and 304 to If-None-Match.
+5. /get, /post, /put, /patch, /delete and /anything echo the request as JSON.
+
+Ref: https://httpbin.org/
+*/
+package stub
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// MaxDelay is the longest delay of /delay/{seconds}, the same as httpbin
+	MaxDelay = 10 * time.Second
+
+	defaultFailureRate   = 0.5
+	defaultFailureStatus = http.StatusInternalServerError
+)
+
+// NewHandler returns the handler of stub endpoints
+func NewHandler() http.Handler {
+	router := chi.NewRouter()
+	router.HandleFunc("/status/{codes}", status)
+	router.HandleFunc("/delay/{seconds}", delay)
+	router.HandleFunc("/flaky", flaky)
+	router.Get("/cache/{seconds}", cache)
+	router.Get("/get", echo)
+	router.Post("/post", echo)
+	router.Put("/put", echo)
+	router.Patch("/patch", echo)
+	router.Delete("/delete", echo)
+	router.HandleFunc("/anything", echo)
+	router.HandleFunc("/anything/*", echo)
+
+	return router
+}
+
+// NewTestServer starts a stub server on a random local port, the caller should Close it
+func NewTestServer() *httptest.Server {
+	return httptest.NewServer(NewHandler())
+}
+
+// ListenAndServe runs a stub server on addr until ctx is done
+func ListenAndServe(ctx context.Context, addr string) error {
+	srv := &http.Server{Addr: addr, Handler: NewHandler()}
+	go func() {
+		<-ctx.Done()
+		srv.Shutdown(context.Background())
+	}()
+
+	log.Infof("***** [SERVER:STUB] ***** Start a stub server of httpbin on %s ......", addr)
+	if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+func status(w http.ResponseWriter, r *http.Request) {
+	codes := strings.Split(chi.URLParam(r, "codes"), ",")
+	code, err := strconv.Atoi(strings.TrimSpace(codes[rand.Intn(len(codes))]))
+	if err != nil || code < 100 || code > 599 {
+		http.Error(w, "invalid status code", http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(code)
+}
+
+func delay(w http.ResponseWriter, r *http.Request) {
+	seconds, err := strconv.ParseFloat(chi.URLParam(r, "seconds"), 64)
+	if err != nil || seconds < 0 {
+		http.Error(w, "invalid delay", http.StatusBadRequest)
+		return
+	}
+	d := time.Duration(seconds * float64(time.Second))
+	if d > MaxDelay {
+		d = MaxDelay
+	}
+
+	select {
+	case <-time.After(d):
+		echo(w, r)
+	case <-r.Context().Done():
+	}
+}
+
+func flaky(w http.ResponseWriter, r *http.Request) {
+	rate := defaultFailureRate
+	if v := r.URL.Query().Get("failure"); v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || f < 0 || f > 1 {
+			http.Error(w, "failure must be between 0 and 1", http.StatusBadRequest)
+			return
+		}
+		rate = f
+	}
+	code := defaultFailureStatus
+	if v := r.URL.Query().Get("status"); v != "" {
+		c, err := strconv.Atoi(v)
+		if err != nil || c < 100 || c > 599 {
+			http.Error(w, "invalid status code", http.StatusBadRequest)
+			return
+		}
+		code = c
+	}
+
+	if rand.Float64() < rate {
+		w.WriteHeader(code)
+		return
+	}
+	echo(w, r)
+}
+
+func cache(w http.ResponseWriter, r *http.Request) {
+	seconds, err := strconv.Atoi(chi.URLParam(r, "seconds"))
+	if err != nil || seconds < 0 {
+		http.Error(w, "invalid max-age", http.StatusBadRequest)
+		return
+	}
+
+	etag := fmt.Sprintf(`"%d"`, seconds)
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", seconds))
+	w.Header().Set("ETag", etag)
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	echo(w, r)
+}
+
+// echo responds with method, URL, headers and body of the request
+func echo(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+	headers := map[string]string{}
+	for key := range r.Header {
+		headers[key] = r.Header.Get(key)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"method":  r.Method,
+		"url":     r.URL.String(),
+		"headers": headers,
+		"data":    string(body),
+	})
+}
@@ -0,0 +1,29 @@
+package tracing
+
+import (
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// LogHook adds trace_id and span_id to entries logged with the context of a span, e.g. log.WithContext(ctx)
+type LogHook struct{}
+
+// Levels implements logrus.Hook
+func (LogHook) Levels() []log.Level {
+	return log.AllLevels
+}
+
+// Fire implements logrus.Hook
+func (LogHook) Fire(entry *log.Entry) error {
+	if entry.Context == nil {
+		return nil
+	}
+	sc := trace.SpanContextFromContext(entry.Context)
+	if !sc.IsValid() {
+		return nil
+	}
+
+	entry.Data["trace_id"] = sc.TraceID().String()
+	entry.Data["span_id"] = sc.SpanID().String()
+	return nil
+}
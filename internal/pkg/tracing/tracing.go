@@ -0,0 +1,127 @@
+/*
+Package tracing configures OpenTelemetry tracing of Artemis. Spans are exported to stdout or an OTLP collector by
+"tracing.exporter", and W3C Trace Context is propagated through "traceparent" and "tracestate" headers.
+
+Ref: https://opentelemetry.io/docs/languages/go/
+*/
+package tracing
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/linushung/artemis/internal/pkg/configs"
+)
+
+const (
+	instrumentationName = "github.com/linushung/artemis"
+	defaultServiceName  = "artemis"
+	defaultSampleRatio  = 1.0
+)
+
+// Exporters of spans
+const (
+	ExporterNone   = "none"
+	ExporterStdout = "stdout"
+	ExporterOTLP   = "otlp"
+)
+
+// Config represents "tracing"
+type Config struct {
+	Exporter    string `mapstructure:"exporter"`
+	ServiceName string `mapstructure:"servicename"`
+	// SampleRatio is the ratio of root spans sampled, child spans follow the decision of their parent
+	SampleRatio float64 `mapstructure:"sampleratio"`
+	OTLP        struct {
+		// Endpoint is host and port of OTLP/HTTP collector, e.g. "localhost:4318"
+		Endpoint string `mapstructure:"endpoint"`
+		Insecure bool   `mapstructure:"insecure"`
+	} `mapstructure:"otlp"`
+}
+
+// DefaultConfig returns Config of default values, which are kept for keys not set in configuration
+func DefaultConfig() Config {
+	return Config{Exporter: ExporterNone, ServiceName: defaultServiceName, SampleRatio: defaultSampleRatio}
+}
+
+// Validate checks exporter and its endpoint, and ratio of sampling
+func (c Config) Validate() error {
+	var errs configs.Errors
+	switch c.Exporter {
+	case ExporterNone, ExporterStdout:
+	case ExporterOTLP:
+		if c.OTLP.Endpoint == "" {
+			errs.Addf("otlp.endpoint", "is required by exporter %s", ExporterOTLP)
+		}
+	default:
+		errs.Addf("exporter", "must be one of none, stdout and otlp, got %q", c.Exporter)
+	}
+	if c.SampleRatio < 0 || c.SampleRatio > 1 {
+		errs.Addf("sampleratio", "must be between 0 and 1, got %v", c.SampleRatio)
+	}
+	return errs.Err()
+}
+
+/*
+Init installs the tracer provider and propagator of Artemis by c and returns the function flushing spans on shutdown.
+Spans are still created and propagated with exporter "none", so trace IDs in logs are consistent across services.
+*/
+func Init(c Config) func(context.Context) error {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	exporter, err := newExporter(c)
+	if err != nil {
+		log.Fatalf("***** [INIT:TRACING][FAIL] ***** Failed to create %s exporter:: %v ......", c.Exporter, err)
+	}
+
+	opts := []sdktrace.TracerProviderOption{
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(c.SampleRatio))),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName(c.ServiceName))),
+	}
+	if exporter != nil {
+		opts = append(opts, sdktrace.WithBatcher(exporter))
+	}
+	tp := sdktrace.NewTracerProvider(opts...)
+	otel.SetTracerProvider(tp)
+
+	log.Infof("***** [INIT:TRACING] ***** Initialise tracing with %s exporter ......", c.Exporter)
+	return tp.Shutdown
+}
+
+func newExporter(c Config) (sdktrace.SpanExporter, error) {
+	switch c.Exporter {
+	case ExporterNone:
+		return nil, nil
+	case ExporterStdout:
+		return stdouttrace.New(stdouttrace.WithPrettyPrint())
+	case ExporterOTLP:
+		opts := []otlptracehttp.Option{otlptracehttp.WithEndpoint(c.OTLP.Endpoint)}
+		if c.OTLP.Insecure {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+		return otlptracehttp.New(context.Background(), opts...)
+	default:
+		return nil, fmt.Errorf("unknown exporter: %s", c.Exporter)
+	}
+}
+
+// Tracer returns the tracer of Artemis
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
+
+// Propagator returns the propagator of W3C Trace Context and Baggage
+func Propagator() propagation.TextMapPropagator {
+	return otel.GetTextMapPropagator()
+}
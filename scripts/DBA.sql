@@ -34,6 +34,17 @@ ALTER TABLE poster DROP CONSTRAINT username_unique;
 
 SELECT count(*), state FROM pg_stat_activity GROUP BY 2;
 
+/* Migration: counters of followers maintained by follow/unfollow transactions, existing databases have to add and
+backfill them before upgrading Artemis. follower.email is the followed poster and follower.follower the username of
+the following one */
+BEGIN;
+ALTER TABLE poster ADD COLUMN IF NOT EXISTS followers_count INTEGER DEFAULT 0 NOT NULL CHECK (followers_count >= 0);
+ALTER TABLE poster ADD COLUMN IF NOT EXISTS following_count INTEGER DEFAULT 0 NOT NULL CHECK (following_count >= 0);
+UPDATE poster p SET
+    followers_count = (SELECT count(*) FROM follower f WHERE f.email = p.email),
+    following_count = (SELECT count(*) FROM follower f WHERE f.follower = p.username);
+COMMIT;
+
 /* Operational SQLs */
 SELECT * FROM ONLY poster;
 
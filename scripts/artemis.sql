@@ -17,6 +17,8 @@ CREATE TABLE poster (
     image VARCHAR(100) DEFAULT '',
     bio VARCHAR(100) DEFAULT '',
     token VARCHAR(100) DEFAULT '',
+    followers_count INTEGER DEFAULT 0 NOT NULL CHECK (followers_count >= 0),
+    following_count INTEGER DEFAULT 0 NOT NULL CHECK (following_count >= 0),
     created_time TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP NOT NULL,
     modified_time TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP NOT NULL,
     /* Ref: